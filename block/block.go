@@ -1,57 +1,102 @@
 package block
 
 import (
-	"crypto/sha256"
 	"encoding/json"
 	"fmt"
 	"time"
 )
 
 type Block struct {
-	timestamp    int64
-	nonce        int
-	prevHash     [32]byte
+	header       BlockHeader
 	transactions []*Transaction
 }
 
-// create hash of block
+// create hash of block, which is the hash of its header
 func (b *Block) Hash() [32]byte {
-	m, _ := b.MarshalJSON()
-	return sha256.Sum256(m)
+	return b.header.Hash()
+}
+
+// check that the hash meets the block's own difficulty
+func (b *Block) ValidProof() bool {
+	return b.header.ValidProof()
+}
+
+func (b *Block) Header() *BlockHeader {
+	return &b.header
+}
+
+func (b *Block) Height() uint64 {
+	return b.header.height
+}
+
+func (b *Block) Difficulty() uint32 {
+	return b.header.difficulty
+}
+
+func (b *Block) Timestamp() int64 {
+	return b.header.timestamp
+}
+
+func (b *Block) Transactions() []*Transaction {
+	return b.transactions
 }
 
 // print function for block
 func (b *Block) Print() {
-	fmt.Printf("nonce: %d\n", b.nonce)
-	fmt.Printf("prevHash: %x\n", b.prevHash)
-	fmt.Printf("timestamp: %d\n", b.timestamp)
+	b.header.Print()
 	for _, t := range b.transactions {
 		t.Print()
 	}
 }
 
-// create new block
-func NewBlock(nonce int, prevHash [32]byte, transactions []*Transaction) *Block {
+// create new block, the merkle root is computed from transactions
+func NewBlock(height uint64, prevHash [32]byte, transactions []*Transaction, difficulty uint32) *Block {
 	block := new(Block)
-	block.timestamp = time.Now().UnixNano()
-	block.nonce = nonce
-	block.prevHash = prevHash
+	block.header.version = BLOCK_VERSION
+	block.header.height = height
+	block.header.timestamp = time.Now().UnixNano()
+	block.header.prevHash = prevHash
+	block.header.merkleRoot = TransactionsMerkleRoot(transactions)
+	block.header.difficulty = difficulty
 	block.transactions = transactions
 	return block
 }
 
+// the first block of every chain
+func GenesisBlock() *Block {
+	block := NewBlock(0, [32]byte{}, []*Transaction{}, 0)
+	block.header.timestamp = GENESIS_TIMESTAMP
+	return block
+}
+
 // marshal block
 
 func (b *Block) MarshalJSON() ([]byte, error) {
 	return json.Marshal(struct {
-		Nonce       int            `json:"nonce"`
-		PrevHash    string         `json:"prevHash"`
-		Timestamp   int64          `json:"timestamp"`
+		*headerJSON
 		Transaction []*Transaction `json:"transactions"`
 	}{
-		Nonce:       b.nonce,
-		PrevHash:    fmt.Sprintf("%x", b.prevHash),
-		Timestamp:   b.timestamp,
+		headerJSON:  b.header.toJSON(),
 		Transaction: b.transactions,
 	})
 }
+
+// unmarshal block
+
+func (b *Block) UnmarshalJSON(data []byte) error {
+	var v struct {
+		headerJSON
+		Transaction []*Transaction `json:"transactions"`
+	}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	if err := b.header.fromJSON(&v.headerJSON); err != nil {
+		return fmt.Errorf("block %d: %w", v.Height, err)
+	}
+	b.transactions = v.Transaction
+	if b.transactions == nil {
+		b.transactions = []*Transaction{}
+	}
+	return nil
+}
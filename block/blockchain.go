@@ -1,177 +1,607 @@
 package block
 
 import (
+	"context"
 	"crypto/ecdsa"
 	"crypto/sha256"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/nazeemnato/stonkcoin/utils"
 	"log"
+	"math/big"
 	"strings"
 	"sync"
 	"time"
 )
 
 const (
-	MINING_DIFFICULTY = 4
-	MINING_SENDER     = "0x0"
-	MINING_REWARD     = 10
-	MINING_EVERY_SEC  = 30
+	MINING_SENDER = "0x0"
+	MINING_REWARD = 10 * utils.COIN
+	// block time the difficulty is retargeted towards
+	MINING_EVERY_SEC = 30
+	// every node starts from the same genesis block, so its timestamp is fixed
+	GENESIS_TIMESTAMP = 1644796800000000000
+)
+
+var (
+	ErrMiningSender        = errors.New("can't send from the mining address")
+	ErrInvalidAmount       = errors.New("amount must be positive")
+	ErrInvalidFee          = errors.New("fee must not be negative")
+	ErrInvalidRecipient    = errors.New("recipient is not a valid address")
+	ErrTransactionTooLarge = errors.New("transaction is too large")
+	ErrInsufficientBalance = errors.New("insufficient balance")
+	ErrDuplicate           = errors.New("transaction already pending")
+	ErrNonceTooLow         = errors.New("nonce already used")
+	ErrNonceGap            = errors.New("nonce is ahead of the sender's sequence")
+	ErrKnownBlock          = errors.New("block is already in the chain")
+	ErrBlockNotOnTip       = errors.New("block does not extend the tip of the chain")
 )
 
 type Blockchain struct {
-	transactionsPool []*Transaction
-	chain            []*Block
-	port             uint16
-	address          string
-	mux              sync.Mutex
+	mempool        *Mempool
+	chain          []*Block
+	port           uint16
+	address        string
+	store          Store
+	blockListeners []func(b *Block)
+	changed        chan struct{}
+	miner          *Miner
+	controller     *MiningController
+	policy         *MonetaryPolicy
+	// confirmed balances, nonces and unspent outputs at the tip, see State
+	state *ledger
+	// what every block changed in the ledger, by height
+	undos []*undo
+	// confirmed transactions per address, see History
+	addresses *addressIndex
+	// blocks by hash and transactions by id
+	blocks *blockIndex
+	// total work behind the chain, see ChainWork
+	work *big.Int
+	// wake up the goroutine writing the pool, see saveTransactionPool
+	saves     chan struct{}
+	quit      chan struct{}
+	saverDone chan struct{}
+	closeOnce sync.Once
+	mux       sync.RWMutex
 }
 
+// blockchain settings, zero value keeps everything in memory
+type Config struct {
+	Store Store
+	// goroutines searching for proof of work, one per cpu when 0
+	MiningWorkers int
+	// pause between mined blocks. 0 mines back to back and leaves the pace
+	// to the difficulty, which aims at MINING_EVERY_SEC seconds per block
+	MiningInterval time.Duration
+	Mempool        MempoolConfig
+	// DefaultMonetaryPolicy when nil
+	Policy *MonetaryPolicy
+}
+
+// balance of an account, Amount is the total of Spendable and Immature
 type AmountRespone struct {
-	Amount float32 `json:"amount"`
+	Amount    utils.Amount `json:"amount"`
+	Spendable utils.Amount `json:"spendable"`
+	Immature  utils.Amount `json:"immature"`
 }
 
 func (ar *AmountRespone) MarshalJSON() ([]byte, error) {
 	return json.Marshal(struct {
-		Amount float32 `json:"amount"`
+		Amount    utils.Amount `json:"amount"`
+		Spendable utils.Amount `json:"spendable"`
+		Immature  utils.Amount `json:"immature"`
 	}{
 		ar.Amount,
+		ar.Spendable,
+		ar.Immature,
 	})
 }
 
-func (bc *Blockchain) CreateTransaction(sender string, recipient string, amount float32, senderPublicKey *ecdsa.PublicKey, signature *utils.Signature) bool {
-	isOk := bc.AddTransaction(sender, recipient, amount, senderPublicKey, signature)
-	return isOk
+func (bc *Blockchain) CreateTransaction(sender string, recipient string, amount utils.Amount, fee utils.Amount, nonce uint64, senderPublicKey *ecdsa.PublicKey, signature *utils.Signature) error {
+	return bc.AddTransaction(sender, recipient, amount, fee, nonce, senderPublicKey, signature)
 }
 
+// pending transactions in arrival order
 func (bc *Blockchain) TransactionPool() []*Transaction {
-	return bc.transactionsPool
+	return bc.mempool.Transactions()
 }
 
-func (bc *Blockchain) AddTransaction(sender string, recipient string, amount float32, senderPublicKey *ecdsa.PublicKey, signature *utils.Signature) bool {
-	t := NewTransaction(sender, recipient, amount)
-	// check sender is mining address
+// the pool of transactions waiting to be mined
+func (bc *Blockchain) Mempool() *Mempool {
+	return bc.mempool
+}
+
+// drop a pending transaction and the sender's later ones that depend on it
+func (bc *Blockchain) RemoveTransaction(id [32]byte) []*Transaction {
+	bc.mux.Lock()
+	defer bc.mux.Unlock()
+	removed := bc.mempool.Remove(id)
+	if len(removed) > 0 {
+		bc.saveTransactionPool()
+		bc.notifyChange()
+	}
+	return removed
+}
+
+func (bc *Blockchain) AddTransaction(sender string, recipient string, amount utils.Amount, fee utils.Amount, nonce uint64, senderPublicKey *ecdsa.PublicKey, signature *utils.Signature) error {
+	bc.mux.Lock()
+	defer bc.mux.Unlock()
+	t := NewSignedTransaction(sender, recipient, amount, fee, nonce, senderPublicKey, signature)
+	// mining rewards are only ever created by Mining()
 	if sender == MINING_SENDER {
-		log.Print("Transaction from the mining reward")
-		bc.transactionsPool = append(bc.transactionsPool, t)
-		return true
+		log.Printf("Error: %s\n", ErrMiningSender)
+		return ErrMiningSender
 	}
-	// calculate sender balance
-	// for testing purpose only
-	// if bc.CalculateTransaction(sender) < amount {
-	// 	log.Println("Error: Not enough balance")
-	// 	return false
-	// }
-	// verify transaction signature
-	if bc.VerifyTransactionSignature(senderPublicKey, signature, t) {
-		bc.transactionsPool = append(bc.transactionsPool, t)
-		return true
-	} else {
-		log.Println("Invalid transaction signature")
-		return false
+	if amount <= 0 {
+		log.Printf("Error: %s\n", ErrInvalidAmount)
+		return ErrInvalidAmount
+	}
+	if fee < 0 {
+		log.Printf("Error: %s\n", ErrInvalidFee)
+		return ErrInvalidFee
 	}
+	// coins sent to a malformed address could never be spent again
+	if !utils.ValidAddress(recipient) {
+		log.Printf("Error: %s\n", ErrInvalidRecipient)
+		return ErrInvalidRecipient
+	}
+	cost, err := t.Cost()
+	if err != nil {
+		log.Printf("Error: %s\n", err)
+		return err
+	}
+	if t.Size() > MAX_BLOCK_SIZE/2 {
+		log.Printf("Error: %s\n", ErrTransactionTooLarge)
+		return ErrTransactionTooLarge
+	}
+	// verify transaction signature and that the key belongs to the sender
+	if err := t.Verify(); err != nil {
+		log.Printf("Invalid transaction: %s\n", err)
+		return err
+	}
+	// replayed or out of order transactions
+	if _, ok := bc.mempool.Get(t.ID()); ok {
+		log.Printf("Error: %s\n", ErrDuplicate)
+		return ErrDuplicate
+	}
+	if bc.mempool.Conflict(t) != nil {
+		log.Printf("Error: %s\n", ErrConflict)
+		return ErrConflict
+	}
+	next := bc.nextNonce(sender)
+	if nonce < next {
+		log.Printf("Error: %s (got %d, expected %d)\n", ErrNonceTooLow, nonce, next)
+		return fmt.Errorf("%w: got %d, expected %d", ErrNonceTooLow, nonce, next)
+	}
+	if nonce > next {
+		log.Printf("Error: %s (got %d, expected %d)\n", ErrNonceGap, nonce, next)
+		return fmt.Errorf("%w: got %d, expected %d", ErrNonceGap, nonce, next)
+	}
+	// confirmed mature balance minus whatever the sender already has pending
+	available := bc.spendableBalance(sender) - bc.pendingSpend(sender)
+	if available < cost {
+		log.Printf("Error: Not enough balance (%s available, %s requested)\n", available, cost)
+		return fmt.Errorf("%w: %s available, %s requested", ErrInsufficientBalance, available, cost)
+	}
+	evicted, err := bc.mempool.Add(t)
+	if err != nil {
+		log.Printf("Error: %s\n", err)
+		return err
+	}
+	for _, e := range evicted {
+		log.Printf("Evicted transaction %x from %s\n", e.ID(), e.senderAddress)
+	}
+	bc.saveTransactionPool()
+	bc.notifyChange()
+	return nil
+}
+
+// amount and fees the address is paying in transactions that are not mined
+// yet
+func (bc *Blockchain) pendingSpend(address string) utils.Amount {
+	var amount utils.Amount = 0
+	for _, t := range bc.mempool.BySender(address) {
+		amount += t.debit()
+	}
+	return amount
+}
 
+// number of transfers the address has mined, which is the nonce its next
+// transaction must carry
+func (bc *Blockchain) confirmedNonce(address string) uint64 {
+	return bc.state.nonces[address]
+}
+
+// next nonce for the address, counting the transactions it has pending
+func (bc *Blockchain) NextNonce(address string) uint64 {
+	bc.mux.RLock()
+	defer bc.mux.RUnlock()
+	return bc.nextNonce(address)
+}
+
+func (bc *Blockchain) nextNonce(address string) uint64 {
+	return bc.confirmedNonce(address) + uint64(len(bc.mempool.BySender(address)))
+}
+
+// re-check the pool against the confirmed balances and nonces right before
+// mining, dropping anything that expired, would overspend or is out of
+// sequence, so a block never holds conflicting spends
+func (bc *Blockchain) pruneTransactionPool() {
+	expired := bc.mempool.Expire()
+	for _, t := range expired {
+		log.Printf("Dropping transaction from %s: expired\n", t.senderAddress)
+	}
+	balances := make(map[string]utils.Amount)
+	nonces := make(map[string]uint64)
+	spent := make(map[OutPoint]bool)
+	dropped := bc.mempool.Retain(func(t *Transaction) bool {
+		if t.IsUTXO() {
+			if err := checkUTXO(t, bc.state.utxos); err != nil {
+				log.Printf("Dropping transaction %x: %s\n", t.ID(), err)
+				return false
+			}
+			for _, in := range t.inputs {
+				if spent[in.outPoint] {
+					log.Printf("Dropping transaction %x: %s\n", t.ID(), ErrOutputPending)
+					return false
+				}
+			}
+			for _, in := range t.inputs {
+				spent[in.outPoint] = true
+			}
+			if t.senderAddress == "" {
+				return true
+			}
+		}
+		if _, ok := balances[t.senderAddress]; !ok {
+			balances[t.senderAddress] = bc.spendableBalance(t.senderAddress)
+			nonces[t.senderAddress] = bc.confirmedNonce(t.senderAddress)
+		}
+		if t.nonce != nonces[t.senderAddress] {
+			log.Printf("Dropping transaction from %s: nonce %d, expected %d\n", t.senderAddress, t.nonce, nonces[t.senderAddress])
+			return false
+		}
+		cost, err := t.Cost()
+		if err != nil || balances[t.senderAddress] < cost {
+			log.Printf("Dropping transaction from %s: %s\n", t.senderAddress, ErrInsufficientBalance)
+			return false
+		}
+		balances[t.senderAddress] -= cost
+		nonces[t.senderAddress]++
+		return true
+	})
+	if len(expired) > 0 || len(dropped) > 0 {
+		bc.saveTransactionPool()
+		bc.notifyChange()
+	}
 }
 
 func (bc *Blockchain) CopyTransactionPool() []*Transaction {
 	transactions := make([]*Transaction, 0)
-	for _, t := range bc.transactionsPool {
-		transactions = append(transactions, NewTransaction(t.senderAddress, t.recipientAddress, t.amount))
+	for _, t := range bc.mempool.Transactions() {
+		c := *t
+		transactions = append(transactions, &c)
 	}
 	return transactions
 }
 
-func (bc *Blockchain) ValidProof(nonce int, prevHash [32]byte, transactions []*Transaction, difficulty int) bool {
-	zeros := strings.Repeat("0", difficulty)
-	guessBlock := Block{
-		0,
-		nonce,
-		prevHash,
-		transactions,
-	}
-	guessHash := fmt.Sprintf("%x", guessBlock.Hash())
-	return guessHash[:difficulty] == zeros
+// check the block hash against the difficulty it carries
+func (bc *Blockchain) ValidProof(b *Block) bool {
+	return b.ValidProof()
 }
 
-func (bc *Blockchain) ProofOfWork() int {
-	transactions := bc.CopyTransactionPool()
-	prevHash := bc.LastBlock().Hash()
-	nonce := 0
-	for !bc.ValidProof(nonce, prevHash, transactions, MINING_DIFFICULTY) {
-		nonce += 1
-	}
-	return nonce
+// build the next block from the pool and search for a nonce that meets the
+// difficulty. the chain is not locked during the search
+func (bc *Blockchain) ProofOfWork() *Block {
+	b := bc.BlockTemplate(bc.address)
+	b.header.nonce, _ = bc.miner.Solve(context.Background(), b.header)
+	return b
 }
 
 func (bc *Blockchain) Print() {
-	for i, block := range bc.chain {
+	for i, block := range bc.Chain() {
 		fmt.Printf("%s Chain %d %s\n", strings.Repeat("=", 25), i, strings.Repeat("=", 25))
 		block.Print()
 	}
 	fmt.Printf("%s\n", strings.Repeat("*", 50))
 }
 
+// create in memory blockchain, panics if it can't be set up
 func NewBlockchain(address string, port uint16) *Blockchain {
-	block := &Block{}
+	bc, err := NewBlockchainWithConfig(address, port, Config{})
+	if err != nil {
+		panic(err)
+	}
+	return bc
+}
+
+// create blockchain backed by config.Store, reloading and re-validating
+// whatever the store already holds
+func NewBlockchainWithConfig(address string, port uint16, config Config) (*Blockchain, error) {
 	bc := new(Blockchain)
 	bc.address = address
 	bc.port = port
-	bc.CreateBlock(0, block.Hash())
-	return bc
+	bc.store = config.Store
+	bc.changed = make(chan struct{})
+	bc.saves = make(chan struct{}, 1)
+	bc.quit = make(chan struct{})
+	bc.saverDone = make(chan struct{})
+	bc.miner = NewMiner(config.MiningWorkers)
+	bc.mempool = NewMempool(config.Mempool)
+	bc.state = newLedger()
+	bc.addresses = newAddressIndex()
+	bc.blocks = newBlockIndex()
+	bc.work = new(big.Int)
+	bc.policy = config.Policy
+	if bc.policy == nil {
+		bc.policy = DefaultMonetaryPolicy()
+	}
+	if err := bc.policy.Validate(); err != nil {
+		return nil, err
+	}
+	bc.controller = NewMiningController(bc, address, config.MiningInterval)
+	if bc.store == nil {
+		bc.store = NewMemoryStore()
+	}
+	if err := bc.load(); err != nil {
+		return nil, err
+	}
+	if len(bc.chain) == 0 {
+		if err := bc.appendBlock(GenesisBlock(), newUndo()); err != nil {
+			return nil, fmt.Errorf("could not store genesis block: %w", err)
+		}
+	}
+	go bc.saveLoop()
+	return bc, nil
+}
+
+// load blocks and pending transactions from the store
+func (bc *Blockchain) load() error {
+	blocks, err := bc.store.LoadBlocks()
+	if err != nil {
+		return err
+	}
+	if len(blocks) > 0 {
+		state, undos, err := validateChain(blocks, bc.policy)
+		if err != nil {
+			return fmt.Errorf("stored chain is invalid: %w", err)
+		}
+		bc.state = state
+		bc.undos = undos
+	}
+	pending, err := bc.store.LoadTransactions()
+	if err != nil {
+		return err
+	}
+	bc.chain = blocks
+	bc.work = ChainWork(blocks)
+	bc.addresses = addressIndexOf(blocks)
+	bc.blocks = blockIndexOf(blocks)
+	restored := bc.restoreTransactions(pending)
+	if len(blocks) > 0 {
+		log.Printf("Loaded %d blocks and %d pending transactions\n", len(blocks), restored)
+	}
+	return nil
+}
+
+// put transactions back in front of the pool, dropping any whose signatures
+// don't check out. they come from disk or from blocks that left the chain
+// and are not trusted more than anything a client sends. returns how many
+// were kept
+func (bc *Blockchain) restoreTransactions(pending []*PendingTransaction) int {
+	valid := make([]*PendingTransaction, 0, len(pending))
+	for _, p := range pending {
+		if err := p.Transaction.Verify(); err != nil {
+			log.Printf("Dropping restored transaction %x: %s\n", p.Transaction.ID(), err)
+			continue
+		}
+		valid = append(valid, p)
+	}
+	bc.mempool.Restore(valid)
+	return len(valid)
+}
+
+// transactions of blocks that left the chain, pending from now on
+func orphans(transactions []*Transaction) []*PendingTransaction {
+	now := time.Now()
+	pending := make([]*PendingTransaction, len(transactions))
+	for i, t := range transactions {
+		pending[i] = &PendingTransaction{t, now}
+	}
+	return pending
+}
+
+// ask for the pool to be written to the store. called with the lock held,
+// the write happens on its own goroutine, which batches every change made
+// within MEMPOOL_SAVE_DELAY into one
+func (bc *Blockchain) saveTransactionPool() {
+	select {
+	case bc.saves <- struct{}{}:
+	default:
+		// a write is already due
+	}
+}
+
+func (bc *Blockchain) saveLoop() {
+	defer close(bc.saverDone)
+	for {
+		select {
+		case <-bc.saves:
+		case <-bc.quit:
+			return
+		}
+		select {
+		case <-time.After(MEMPOOL_SAVE_DELAY):
+		case <-bc.quit:
+		}
+		bc.writeTransactionPool()
+	}
+}
+
+// the mempool has its own lock, the chain stays unlocked while writing
+func (bc *Blockchain) writeTransactionPool() {
+	if err := bc.store.SaveTransactions(bc.mempool.Pending()); err != nil {
+		log.Printf("Error saving transaction pool: %s\n", err)
+	}
+}
+
+// write the pool one last time and close the underlying store
+func (bc *Blockchain) Close() error {
+	err := errors.New("blockchain already closed")
+	bc.closeOnce.Do(func() {
+		close(bc.quit)
+		<-bc.saverDone
+		bc.writeTransactionPool()
+		err = bc.store.Close()
+	})
+	return err
+}
+
+// blocks on the chain, copied under the lock so they can be used after it
+// is released
+func (bc *Blockchain) Chain() []*Block {
+	bc.mux.RLock()
+	defer bc.mux.RUnlock()
+	return append([]*Block{}, bc.chain...)
 }
 
 func (bc *Blockchain) MarshalJSON() ([]byte, error) {
-	return json.Marshal(bc.chain)
+	return json.Marshal(bc.Chain())
+}
+
+// add a block received from a peer on top of the chain
+func (bc *Blockchain) AddBlock(b *Block) error {
+	bc.mux.Lock()
+	defer bc.mux.Unlock()
+	last := bc.lastBlock()
+	if b.header.prevHash != last.Hash() {
+		hash := b.Hash()
+		for _, c := range bc.chain {
+			if c.Hash() == hash {
+				return ErrKnownBlock
+			}
+		}
+		return ErrBlockNotOnTip
+	}
+	u, err := bc.state.applyBlock(bc.chain, b, bc.policy)
+	if err != nil {
+		return err
+	}
+	return bc.appendBlock(b, u)
 }
 
-func (bc *Blockchain) CreateBlock(nonce int, prevHash [32]byte) *Block {
-	block := NewBlock(nonce, prevHash, bc.transactionsPool)
-	bc.chain = append(bc.chain, block)
-	bc.transactionsPool = []*Transaction{}
-	return block
+// store a block already applied to the ledger, put it on the chain and drop
+// its transactions from the pool. u is what applying it changed
+func (bc *Blockchain) appendBlock(b *Block, u *undo) error {
+	// the block only becomes part of the chain once it is on disk
+	if err := bc.store.AppendBlock(b); err != nil {
+		bc.state.revert(u)
+		return err
+	}
+	bc.chain = append(bc.chain, b)
+	bc.work.Add(bc.work, headerWork(&b.header))
+	bc.undos = append(bc.undos, u)
+	bc.addresses.add(b)
+	bc.blocks.add(b)
+	bc.mempool.RemoveMined(b.transactions)
+	bc.pruneTransactionPool()
+	bc.saveTransactionPool()
+	bc.notifyChange()
+	if len(bc.chain) > 1 {
+		for _, fn := range bc.blockListeners {
+			fn(b)
+		}
+	}
+	return nil
+}
+
+// register fn to be called with every block added to the chain, it runs
+// while the chain is locked so it must not call back into the blockchain
+func (bc *Blockchain) OnNewBlock(fn func(b *Block)) {
+	bc.mux.Lock()
+	defer bc.mux.Unlock()
+	bc.blockListeners = append(bc.blockListeners, fn)
+}
+
+// up to limit headers starting at height from, for headers only sync
+func (bc *Blockchain) Headers(from uint64, limit int) []*BlockHeader {
+	bc.mux.RLock()
+	defer bc.mux.RUnlock()
+	headers := make([]*BlockHeader, 0)
+	for h := from; h < uint64(len(bc.chain)) && len(headers) < limit; h++ {
+		header := bc.chain[h].header
+		headers = append(headers, &header)
+	}
+	return headers
 }
 
 func (bc *Blockchain) LastBlock() *Block {
+	bc.mux.RLock()
+	defer bc.mux.RUnlock()
+	return bc.lastBlock()
+}
+
+func (bc *Blockchain) lastBlock() *Block {
 	return bc.chain[len(bc.chain)-1]
 }
 
+// mine one block paying the reward address of the mining controller, false
+// while the controller is mining in the background. blocks are mined even
+// with an empty pool, the coinbase is the only way anyone gets a balance to
+// spend
 func (bc *Blockchain) Mining() bool {
-	bc.mux.Lock()
-	defer bc.mux.Unlock()
-	if len(bc.transactionsPool) == 0 {
+	return bc.MiningContext(context.Background())
+}
+
+// same as Mining, giving up when ctx is done
+func (bc *Blockchain) MiningContext(ctx context.Context) bool {
+	b, err := bc.controller.MineOnce(ctx)
+	if err != nil {
+		log.Printf("Error mining block: %s\n", err)
 		return false
 	}
-	bc.AddTransaction(MINING_SENDER, bc.address, MINING_REWARD, nil, nil)
-	nonce := bc.ProofOfWork()
-	prevHash := bc.LastBlock().Hash()
-	bc.CreateBlock(nonce, prevHash)
+	log.Printf("Mined block %d with %d transactions\n", b.Height(), len(b.transactions))
 	fmt.Println("Success!")
 	return true
 }
 
-func (bc *Blockchain) StartMining() {
-	bc.Mining()
-	_ = time.AfterFunc(time.Second*MINING_EVERY_SEC, bc.StartMining)
+// mine in the background, false if that is already happening
+func (bc *Blockchain) StartMining() bool {
+	return bc.controller.Start()
 }
 
-func (bc *Blockchain) CalculateTransaction(address string) float32 {
-	var amount float32 = 0
-	for _, c := range bc.chain {
-		for _, t := range c.transactions {
-			if address == t.senderAddress {
-				amount -= t.amount
-			}
+// stop background mining, false if it was not running
+func (bc *Blockchain) StopMining() bool {
+	return bc.controller.Stop()
+}
 
-			if address == t.recipientAddress {
-				amount += t.amount
-			}
-		}
-	}
-	return amount
+// the controller of the background mining loop
+func (bc *Blockchain) MiningController() *MiningController {
+	return bc.controller
+}
+
+// confirmed balance of address
+func (bc *Blockchain) CalculateTransaction(address string) utils.Amount {
+	return bc.State().Balance(address)
+}
+
+// total, spendable and immature balance of address, coinbases only become
+// spendable after CoinbaseMaturity confirmations
+func (bc *Blockchain) Balance(address string) *AmountRespone {
+	return bc.State().Account(address)
+}
+
+// what address can spend in the next block
+func (bc *Blockchain) spendableBalance(address string) utils.Amount {
+	return bc.state.balances[address] - bc.immature(address)
 }
 
 func (bc *Blockchain) VerifyTransactionSignature(senderPublicKey *ecdsa.PublicKey, signature *utils.Signature, transaction *Transaction) bool {
-	m, _ := json.Marshal(transaction)
-	h := sha256.Sum256([]byte(m))
+	if senderPublicKey == nil || signature == nil {
+		return false
+	}
+	h := sha256.Sum256(transaction.SigningPayload())
 	return ecdsa.Verify(senderPublicKey, h[:], signature.R, signature.S)
 }
@@ -0,0 +1,53 @@
+package block
+
+import (
+	"crypto/ecdsa"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/nazeemnato/stonkcoin/utils"
+)
+
+// pending transactions read back from the store are verified again, ones
+// missing a public key are dropped instead of reaching the utxo checks
+func TestRestoreTransactions(t *testing.T) {
+	ka, a := testKey(t)
+	_, b := testKey(t)
+	valid := testSignedTransfer(ka, b, utils.COIN, 0, 0)
+	unsigned := testSignedTransfer(ka, b, utils.COIN, 0, 1)
+	unsigned.senderPublicKey = nil
+	spend := testUTXOTransaction([]OutPoint{NewOutPoint([32]byte{1}, 0)}, []*ecdsa.PrivateKey{ka}, []*TxOutput{NewTxOutput(a, utils.COIN)}, 0)
+	spend.inputs[0].publicKey = nil
+	added := time.Now().Add(-time.Hour).Round(0)
+	pending := []*PendingTransaction{{valid, added}, {unsigned, added}, {spend, added}}
+	// through json like a FileStore, a missing key decodes to nil
+	m, err := json.Marshal(pending)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var stored []*PendingTransaction
+	if err := json.Unmarshal(m, &stored); err != nil {
+		t.Fatal(err)
+	}
+	// a can spend its coinbase right away, the transfer is kept
+	policy := DefaultMonetaryPolicy()
+	policy.CoinbaseMaturity = 1
+	chain := []*Block{GenesisBlock()}
+	chain = append(chain, testBlock(t, chain, a, policy))
+	store := NewMemoryStore()
+	store.ReplaceBlocks(chain)
+	store.SaveTransactions(stored)
+	bc, err := NewBlockchainWithConfig(a, 0, Config{Store: store, Policy: policy})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer bc.Close()
+	restored := bc.Mempool().Pending()
+	if len(restored) != 1 || restored[0].Transaction.ID() != valid.ID() {
+		t.Fatalf("restored %d transactions, want only the signed transfer", len(restored))
+	}
+	if !restored[0].Added.Equal(added) {
+		t.Errorf("restored transaction was added at %s, want %s", restored[0].Added, added)
+	}
+}
@@ -0,0 +1,213 @@
+package block
+
+import (
+	"fmt"
+	"log"
+	"math/big"
+	"sort"
+)
+
+// fetch all of a peer's headers, starting with its genesis block
+type HeadersFetcher func(peer string) ([]*BlockHeader, error)
+
+// fetch a peer's blocks from height from up to its tip
+type BlocksFetcher func(peer string, from uint64) ([]*Block, error)
+
+// expected number of hashes it took to mine the header
+func headerWork(h *BlockHeader) *big.Int {
+	return new(big.Int).Lsh(big.NewInt(1), uint(h.difficulty))
+}
+
+// total work behind a chain, the heaviest valid chain wins
+func ChainWork(blocks []*Block) *big.Int {
+	work := new(big.Int)
+	for _, b := range blocks {
+		work.Add(work, headerWork(&b.header))
+	}
+	return work
+}
+
+// same as ChainWork for a chain of headers only
+func HeadersWork(headers []*BlockHeader) *big.Int {
+	work := new(big.Int)
+	for _, h := range headers {
+		work.Add(work, headerWork(h))
+	}
+	return work
+}
+
+// ask every peer for its headers and switch to the heaviest valid chain if
+// it outweighs ours, true if the local chain was replaced. only the blocks
+// after the fork with our chain are downloaded, and only from peers whose
+// headers carry more work
+func (bc *Blockchain) ResolveConflicts(peers []string, fetchHeaders HeadersFetcher, fetchBlocks BlocksFetcher) (bool, error) {
+	type candidate struct {
+		peer    string
+		headers []*BlockHeader
+		fork    int
+		work    *big.Int
+	}
+	bc.mux.RLock()
+	localWork := new(big.Int).Set(bc.work)
+	local := make([][32]byte, len(bc.chain))
+	for i, b := range bc.chain {
+		local[i] = b.Hash()
+	}
+	bc.mux.RUnlock()
+	// fetching is done without holding the lock
+	candidates := make([]candidate, 0)
+	for _, p := range peers {
+		headers, err := fetchHeaders(p)
+		if err != nil {
+			log.Printf("Error fetching headers from %s: %s\n", p, err)
+			continue
+		}
+		if len(headers) == 0 {
+			continue
+		}
+		work := HeadersWork(headers)
+		if work.Cmp(localWork) <= 0 {
+			continue
+		}
+		if err := validateHeaders(headers); err != nil {
+			log.Printf("Ignoring headers from %s: %s\n", p, err)
+			continue
+		}
+		fork := 0
+		for fork < len(local) && fork < len(headers) && local[fork] == headers[fork].Hash() {
+			fork++
+		}
+		candidates = append(candidates, candidate{p, headers, fork, work})
+	}
+	// heaviest first, ReplaceChain only validates the blocks after the fork
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].work.Cmp(candidates[j].work) > 0
+	})
+	var err error
+	for _, c := range candidates {
+		var blocks []*Block
+		blocks, err = fetchBlocks(c.peer, uint64(c.fork))
+		if err == nil {
+			err = matchHeaders(blocks, c.headers[c.fork:])
+		}
+		if err == nil {
+			// ReplaceChain finds the fork again, our chain may have moved
+			ours := bc.Chain()
+			if len(ours) < c.fork {
+				err = fmt.Errorf("local chain changed while fetching")
+			} else {
+				err = bc.ReplaceChain(append(ours[:c.fork:c.fork], blocks...))
+			}
+		}
+		if err == nil {
+			return true, nil
+		}
+		log.Printf("Ignoring chain from %s: %s\n", c.peer, err)
+	}
+	return false, err
+}
+
+// check proof of work, difficulty and linkage of a peer's headers before any
+// of its blocks are downloaded
+func validateHeaders(headers []*BlockHeader) error {
+	if headers[0].Hash() != GenesisBlock().Hash() {
+		return blockError(0, "genesis block does not match")
+	}
+	for i := 1; i < len(headers); i++ {
+		if err := ValidateHeader(headers[i-1], headers[i], NextHeaderDifficulty(headers[:i])); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// blocks have to be the ones the headers promised
+func matchHeaders(blocks []*Block, headers []*BlockHeader) error {
+	if len(blocks) != len(headers) {
+		return fmt.Errorf("got %d blocks, the headers promised %d", len(blocks), len(headers))
+	}
+	for i, b := range blocks {
+		if b.Hash() != headers[i].Hash() {
+			return blockError(int(headers[i].height), "block does not match its header")
+		}
+	}
+	return nil
+}
+
+// swap in a heavier valid chain, transactions only the old chain had go back
+// into the pool. the ledger is rewound to the fork and the new blocks are
+// applied on top, the local chain is left alone if any of them is invalid
+func (bc *Blockchain) ReplaceChain(blocks []*Block) error {
+	bc.mux.Lock()
+	defer bc.mux.Unlock()
+	if len(blocks) == 0 || blocks[0].Hash() != bc.chain[0].Hash() {
+		return blockError(0, "genesis block does not match")
+	}
+	// our chain may have grown while the new one was fetched
+	work := ChainWork(blocks)
+	if work.Cmp(bc.work) <= 0 {
+		return fmt.Errorf("chain is not heavier than the local chain")
+	}
+	fork := 0
+	for fork < len(bc.chain) && fork < len(blocks) && bc.chain[fork].Hash() == blocks[fork].Hash() {
+		fork++
+	}
+	// blocks up to the fork are ours already, whatever the peer sent along
+	// with their headers is not looked at
+	chain := append(bc.chain[:fork:fork], blocks[fork:]...)
+	bc.state.rewind(bc.undos, fork)
+	undos, verr := bc.state.replay(chain, fork, bc.policy)
+	if verr != nil {
+		bc.restoreLedger(fork)
+		return verr
+	}
+	if err := bc.store.ReplaceBlocks(chain); err != nil {
+		bc.state.rewind(undos, 0)
+		bc.restoreLedger(fork)
+		return err
+	}
+	included := make(map[[32]byte]bool)
+	for _, b := range chain[fork:] {
+		for _, t := range b.transactions {
+			included[t.ID()] = true
+		}
+	}
+	orphaned := make([]*Transaction, 0)
+	for _, b := range bc.chain[fork:] {
+		for _, t := range b.transactions {
+			if !t.IsCoinbase() && !included[t.ID()] {
+				orphaned = append(orphaned, t)
+			}
+		}
+	}
+	log.Printf("Replaced chain at height %d: %d blocks dropped, %d added, %d transactions back in the pool\n", fork, len(bc.chain)-fork, len(chain)-fork, len(orphaned))
+	for i := len(bc.chain) - 1; i >= fork; i-- {
+		bc.addresses.remove(bc.chain[i])
+		bc.blocks.remove(bc.chain[i])
+	}
+	for _, b := range chain[fork:] {
+		bc.addresses.add(b)
+		bc.blocks.add(b)
+	}
+	bc.chain = chain
+	bc.work = work
+	bc.undos = append(bc.undos[:fork:fork], undos...)
+	// orphans are older than anything still pending, so they go first
+	bc.restoreTransactions(orphans(orphaned))
+	bc.pruneTransactionPool()
+	bc.saveTransactionPool()
+	bc.notifyChange()
+	return nil
+}
+
+// apply the local blocks after fork again once a new chain turned out to be
+// invalid, the ledger has to be at the fork
+func (bc *Blockchain) restoreLedger(fork int) {
+	undos, err := bc.state.replay(bc.chain, fork, bc.policy)
+	if err != nil {
+		// they were valid before, only the clock could have changed
+		log.Printf("Error restoring the ledger: %s\n", err)
+		return
+	}
+	copy(bc.undos[fork:], undos)
+}
@@ -0,0 +1,135 @@
+package block
+
+import (
+	"testing"
+
+	"github.com/nazeemnato/stonkcoin/utils"
+)
+
+// switching to a heavier chain rewinds the ledger to the fork and replays
+// the new blocks, the result has to match validating the chain from scratch
+func TestReplaceChain(t *testing.T) {
+	policy := DefaultMonetaryPolicy()
+	policy.CoinbaseMaturity = 2
+	ka, a := testKey(t)
+	_, b := testKey(t)
+	A, err := NewBlockchainWithConfig(a, 0, Config{Policy: policy, MiningWorkers: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer A.Close()
+	B, err := NewBlockchainWithConfig(b, 0, Config{Policy: policy, MiningWorkers: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer B.Close()
+	for i := 0; i < 4; i++ {
+		A.Mining()
+	}
+	tx := testSignedTransfer(ka, b, 3*utils.COIN, utils.COIN/10, 0)
+	if err := A.AddTransaction(a, b, tx.amount, tx.fee, tx.nonce, tx.senderPublicKey, tx.signature); err != nil {
+		t.Fatal(err)
+	}
+	A.Mining()
+	fresh, _, _ := validateChain(A.Chain(), policy)
+	sameLedger(t, A.state, fresh)
+	for i := 0; i < 8; i++ {
+		B.Mining()
+	}
+
+	// a heavier chain with a bad last block is rejected after its other
+	// blocks were replayed, nothing of it may stay behind
+	before := *A.Balance(a)
+	bad := B.Chain()
+	last := *bad[len(bad)-1]
+	last.transactions = append([]*Transaction{NewCoinbaseTransaction(a, 1000*utils.COIN, last.header.height)}, last.transactions[1:]...)
+	bad[len(bad)-1] = &last
+	if err := A.ReplaceChain(bad); err == nil {
+		t.Fatal("chain with an invalid block was accepted")
+	}
+	fresh, _, _ = validateChain(A.Chain(), policy)
+	sameLedger(t, A.state, fresh)
+	if *A.Balance(a) != before {
+		t.Errorf("balance %v after a rejected chain, want %v", A.Balance(a), before)
+	}
+
+	if err := A.ReplaceChain(B.Chain()); err != nil {
+		t.Fatal(err)
+	}
+	fresh, _, _ = validateChain(B.Chain(), policy)
+	sameLedger(t, A.state, fresh)
+	if A.LastBlock().Hash() != B.LastBlock().Hash() {
+		t.Error("tip was not replaced")
+	}
+	// the transfer left the chain but a has nothing on the new one
+	if A.Mempool().Len() != 0 {
+		t.Errorf("%d orphaned transactions kept, want 0", A.Mempool().Len())
+	}
+	// matured coinbases are dropped, only the last ones are still locked
+	if n := len(A.state.coinbases); n > int(policy.CoinbaseMaturity) {
+		t.Errorf("%d coinbases waiting to mature, want at most %d", n, policy.CoinbaseMaturity)
+	}
+}
+
+// headers come first, blocks are only downloaded from the fork on and have
+// to match the headers they were promised by
+func TestResolveConflicts(t *testing.T) {
+	_, a := testKey(t)
+	_, b := testKey(t)
+	A, err := NewBlockchainWithConfig(a, 0, Config{MiningWorkers: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer A.Close()
+	B, err := NewBlockchainWithConfig(b, 0, Config{MiningWorkers: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer B.Close()
+	A.Mining()
+	for i := 0; i < 3; i++ {
+		B.Mining()
+	}
+	headers := func(p string) ([]*BlockHeader, error) {
+		return B.Headers(0, len(B.Chain())), nil
+	}
+	var requested []uint64
+	blocks := func(p string) BlocksFetcher {
+		return func(peer string, from uint64) ([]*Block, error) {
+			requested = append(requested, from)
+			chain := B.Chain()[from:]
+			if p == "liar" {
+				other := *chain[len(chain)-1]
+				other.header.nonce++
+				chain[len(chain)-1] = &other
+			}
+			return chain, nil
+		}
+	}
+	if replaced, err := A.ResolveConflicts([]string{"liar"}, headers, blocks("liar")); replaced || err == nil {
+		t.Fatalf("blocks that don't match their headers were accepted: %v, %v", replaced, err)
+	}
+	if replaced, err := A.ResolveConflicts([]string{"honest"}, headers, blocks("honest")); !replaced || err != nil {
+		t.Fatalf("ResolveConflicts() = %v, %v, want the heavier chain", replaced, err)
+	}
+	for _, from := range requested {
+		if from != 1 {
+			t.Errorf("blocks fetched from height %d, want 1 where the chains fork", from)
+		}
+	}
+	if A.LastBlock().Hash() != B.LastBlock().Hash() {
+		t.Error("tip was not replaced")
+	}
+	// a lighter chain is never downloaded
+	requested = nil
+	A.Mining()
+	// the running total follows appends and replacements
+	if A.Summary().Work.Cmp(ChainWork(A.Chain())) != 0 {
+		t.Errorf("summary work %s, want %s", A.Summary().Work, ChainWork(A.Chain()))
+	}
+	if replaced, _ := A.ResolveConflicts([]string{"honest"}, func(p string) ([]*BlockHeader, error) {
+		return B.Headers(0, 1), nil
+	}, blocks("honest")); replaced || len(requested) != 0 {
+		t.Errorf("lighter chain replaced %v, %d block requests", replaced, len(requested))
+	}
+}
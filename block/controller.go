@@ -0,0 +1,229 @@
+package block
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"sync"
+	"time"
+)
+
+const (
+	MINING_STOPPED = "stopped"
+	MINING_RUNNING = "running"
+	MINING_PAUSED  = "paused"
+)
+
+var ErrMiningBusy = errors.New("the miner is already working on a block")
+
+// runs the miner in the background, one block every interval, until it is
+// stopped or paused
+type MiningController struct {
+	bc            *Blockchain
+	rewardAddress string
+	interval      time.Duration
+	state         string
+	cancel        context.CancelFunc
+	done          chan struct{}
+	blocksFound   uint64
+	lastBlock     *Block
+	lastBlockAt   time.Time
+	// a single block is being mined outside the loop
+	mining bool
+	mux    sync.Mutex
+}
+
+// create stopped controller mining on bc and paying rewardAddress
+func NewMiningController(bc *Blockchain, rewardAddress string, interval time.Duration) *MiningController {
+	return &MiningController{
+		bc:            bc,
+		rewardAddress: rewardAddress,
+		interval:      interval,
+		state:         MINING_STOPPED,
+	}
+}
+
+// start mining, false if it is already running. a paused controller resumes
+func (c *MiningController) Start() bool {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	if c.state == MINING_RUNNING || c.mining {
+		return false
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	c.cancel = cancel
+	c.done = make(chan struct{})
+	c.state = MINING_RUNNING
+	go c.loop(ctx, c.done)
+	if c.interval > 0 {
+		log.Printf("Mining started, paying %s and pausing %s after every block\n", c.rewardAddress, c.interval)
+	} else {
+		log.Printf("Mining started, paying %s\n", c.rewardAddress)
+	}
+	return true
+}
+
+// mine a single block paying the reward address. the loop shares the miner
+// and two searches at once would mix up its hash rate, so this fails with
+// ErrMiningBusy while the loop or another single block is running
+func (c *MiningController) MineOnce(ctx context.Context) (*Block, error) {
+	c.mux.Lock()
+	if c.state == MINING_RUNNING || c.mining {
+		c.mux.Unlock()
+		return nil, ErrMiningBusy
+	}
+	c.mining = true
+	address := c.rewardAddress
+	c.mux.Unlock()
+	defer func() {
+		c.mux.Lock()
+		c.mining = false
+		c.mux.Unlock()
+	}()
+	return c.bc.miner.Mine(ctx, c.bc, address)
+}
+
+// abort the running search and wait for the loop to exit, false if it was
+// not running. Start resumes it
+func (c *MiningController) Pause() bool {
+	return c.halt(MINING_PAUSED)
+}
+
+// stop mining, false if it was already stopped
+func (c *MiningController) Stop() bool {
+	return c.halt(MINING_STOPPED)
+}
+
+func (c *MiningController) halt(state string) bool {
+	c.mux.Lock()
+	if c.state == MINING_STOPPED || (c.state == MINING_PAUSED && state == MINING_PAUSED) {
+		c.mux.Unlock()
+		return false
+	}
+	wasRunning := c.state == MINING_RUNNING
+	c.state = state
+	cancel, done := c.cancel, c.done
+	c.mux.Unlock()
+	if wasRunning {
+		cancel()
+		<-done
+	}
+	log.Printf("Mining %s\n", state)
+	return true
+}
+
+// time to wait after each block, 0 mines back to back
+func (c *MiningController) SetInterval(interval time.Duration) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	c.interval = interval
+}
+
+// address the coinbase of the next block pays
+func (c *MiningController) SetRewardAddress(address string) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	c.rewardAddress = address
+}
+
+func (c *MiningController) RewardAddress() string {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	return c.rewardAddress
+}
+
+func (c *MiningController) State() string {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	return c.state
+}
+
+func (c *MiningController) loop(ctx context.Context, done chan struct{}) {
+	defer close(done)
+	for {
+		c.mux.Lock()
+		address := c.rewardAddress
+		c.mux.Unlock()
+		b, err := c.bc.miner.Mine(ctx, c.bc, address)
+		if ctx.Err() != nil {
+			return
+		}
+		c.mux.Lock()
+		if err != nil {
+			log.Printf("Error mining block: %s\n", err)
+		} else {
+			log.Printf("Mined block %d with %d transactions\n", b.Height(), len(b.transactions))
+			c.blocksFound++
+			c.lastBlock = b
+			c.lastBlockAt = time.Now()
+		}
+		interval := c.interval
+		c.mux.Unlock()
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(interval):
+		}
+	}
+}
+
+// snapshot of what the controller is doing
+type MiningStatus struct {
+	State         string
+	RewardAddress string
+	Interval      time.Duration
+	Workers       int
+	HashRate      float64
+	NoncesTried   uint64
+	BlocksFound   uint64
+	LastBlock     *BlockHeader
+	LastBlockAt   time.Time
+}
+
+func (c *MiningController) Status() *MiningStatus {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	status := &MiningStatus{
+		State:         c.state,
+		RewardAddress: c.rewardAddress,
+		Interval:      c.interval,
+		Workers:       c.bc.miner.Workers(),
+		HashRate:      c.bc.miner.HashRate(),
+		NoncesTried:   c.bc.miner.Hashes(),
+		BlocksFound:   c.blocksFound,
+		LastBlockAt:   c.lastBlockAt,
+	}
+	if c.lastBlock != nil {
+		header := c.lastBlock.header
+		status.LastBlock = &header
+	}
+	return status
+}
+
+func (s *MiningStatus) MarshalJSON() ([]byte, error) {
+	v := struct {
+		State         string       `json:"state"`
+		RewardAddress string       `json:"rewardAddress"`
+		Interval      string       `json:"interval"`
+		Workers       int          `json:"workers"`
+		HashRate      float64      `json:"hashRate"`
+		NoncesTried   uint64       `json:"noncesTried"`
+		BlocksFound   uint64       `json:"blocksFound"`
+		LastBlock     *BlockHeader `json:"lastBlock,omitempty"`
+		LastBlockAt   *time.Time   `json:"lastBlockAt,omitempty"`
+	}{
+		State:         s.State,
+		RewardAddress: s.RewardAddress,
+		Interval:      s.Interval.String(),
+		Workers:       s.Workers,
+		HashRate:      s.HashRate,
+		NoncesTried:   s.NoncesTried,
+		BlocksFound:   s.BlocksFound,
+		LastBlock:     s.LastBlock,
+	}
+	if !s.LastBlockAt.IsZero() {
+		v.LastBlockAt = &s.LastBlockAt
+	}
+	return json.Marshal(v)
+}
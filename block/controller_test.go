@@ -0,0 +1,86 @@
+package block
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestMiningControllerStates(t *testing.T) {
+	_, a := testKey(t)
+	bc, err := NewBlockchainWithConfig(a, 0, Config{MiningWorkers: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer bc.Close()
+	c := bc.MiningController()
+	steps := []struct {
+		name  string
+		do    func() bool
+		ok    bool
+		state string
+	}{
+		{"stop while stopped", c.Stop, false, MINING_STOPPED},
+		{"pause while stopped", c.Pause, false, MINING_STOPPED},
+		{"start", c.Start, true, MINING_RUNNING},
+		{"start again", c.Start, false, MINING_RUNNING},
+		{"pause", c.Pause, true, MINING_PAUSED},
+		{"pause again", c.Pause, false, MINING_PAUSED},
+		{"resume", c.Start, true, MINING_RUNNING},
+		{"stop", c.Stop, true, MINING_STOPPED},
+		{"stop while paused", func() bool { c.Start(); c.Pause(); return c.Stop() }, true, MINING_STOPPED},
+	}
+	for _, s := range steps {
+		if ok := s.do(); ok != s.ok {
+			t.Errorf("%s: %v, want %v", s.name, ok, s.ok)
+		}
+		if state := c.State(); state != s.state {
+			t.Errorf("%s: state %s, want %s", s.name, state, s.state)
+		}
+	}
+}
+
+// blocks found in the background show up in the status
+func TestMiningControllerStatus(t *testing.T) {
+	_, a := testKey(t)
+	bc, err := NewBlockchainWithConfig(a, 0, Config{MiningWorkers: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer bc.Close()
+	c := bc.MiningController()
+	c.Start()
+	deadline := time.Now().Add(30 * time.Second)
+	for c.Status().BlocksFound == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	c.Stop()
+	status := c.Status()
+	if status.BlocksFound == 0 || status.LastBlock == nil {
+		t.Fatal("no block mined in the background")
+	}
+	if status.State != MINING_STOPPED || status.RewardAddress != a {
+		t.Errorf("status %s paying %s, want stopped paying %s", status.State, status.RewardAddress, a)
+	}
+	if h := bc.LastBlock().Height(); h < status.LastBlock.Height() {
+		t.Errorf("chain at height %d, behind the last mined block %d", h, status.LastBlock.Height())
+	}
+}
+
+// a single block is refused while the background loop shares the miner
+func TestMineOnceWhileRunning(t *testing.T) {
+	_, a := testKey(t)
+	bc, err := NewBlockchainWithConfig(a, 0, Config{MiningWorkers: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer bc.Close()
+	bc.MiningController().Start()
+	if _, err := bc.MiningController().MineOnce(context.Background()); err != ErrMiningBusy {
+		t.Errorf("MineOnce() = %v while the loop runs, want %v", err, ErrMiningBusy)
+	}
+	bc.MiningController().Stop()
+	if _, err := bc.MiningController().MineOnce(context.Background()); err != nil {
+		t.Errorf("MineOnce() = %v after stopping, want a block", err)
+	}
+}
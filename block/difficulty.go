@@ -0,0 +1,85 @@
+package block
+
+import (
+	"math"
+	"math/bits"
+	"time"
+)
+
+const (
+	// difficulty is the number of leading zero bits a block hash needs
+	INITIAL_DIFFICULTY = 16
+	MIN_DIFFICULTY     = 8
+	MAX_DIFFICULTY     = 64
+	// retarget every this many blocks
+	DIFFICULTY_ADJUSTMENT_INTERVAL = 10
+	// most a single retarget may move the difficulty, in bits
+	MAX_DIFFICULTY_ADJUSTMENT = 2
+	// measured from block timestamps, so a miner pausing between blocks
+	// looks like a slower network and gets a lower difficulty
+	TARGET_BLOCK_TIME = MINING_EVERY_SEC * time.Second
+	// how far ahead of our clock a block timestamp may be
+	MAX_FUTURE_BLOCK_TIME = 2 * time.Hour
+)
+
+// number of leading zero bits of a hash
+func LeadingZeroBits(hash [32]byte) int {
+	n := 0
+	for _, b := range hash {
+		if b != 0 {
+			return n + bits.LeadingZeros8(b)
+		}
+		n += 8
+	}
+	return n
+}
+
+// difficulty the block following blocks has to carry
+func NextDifficulty(blocks []*Block) uint32 {
+	return nextDifficulty(len(blocks), func(i int) *BlockHeader {
+		return &blocks[i].header
+	})
+}
+
+// same as NextDifficulty for a chain of headers only
+func NextHeaderDifficulty(headers []*BlockHeader) uint32 {
+	return nextDifficulty(len(headers), func(i int) *BlockHeader {
+		return headers[i]
+	})
+}
+
+// every DIFFICULTY_ADJUSTMENT_INTERVAL blocks the time the last interval
+// took is compared with TARGET_BLOCK_TIME and the difficulty moves by the
+// number of bits (powers of two) that are closest to the ratio
+func nextDifficulty(height int, header func(i int) *BlockHeader) uint32 {
+	last := header(height - 1)
+	// the genesis block has no difficulty and a fixed timestamp, the
+	// first window starts after it
+	if height <= DIFFICULTY_ADJUSTMENT_INTERVAL {
+		return INITIAL_DIFFICULTY
+	}
+	if height%DIFFICULTY_ADJUSTMENT_INTERVAL != 0 {
+		return last.difficulty
+	}
+	first := header(height - DIFFICULTY_ADJUSTMENT_INTERVAL)
+	expected := float64(DIFFICULTY_ADJUSTMENT_INTERVAL-1) * float64(TARGET_BLOCK_TIME)
+	actual := float64(last.timestamp - first.timestamp)
+	adjustment := MAX_DIFFICULTY_ADJUSTMENT
+	if actual > 0 {
+		adjustment = int(math.Round(math.Log2(expected / actual)))
+	}
+	if adjustment > MAX_DIFFICULTY_ADJUSTMENT {
+		adjustment = MAX_DIFFICULTY_ADJUSTMENT
+	}
+	if adjustment < -MAX_DIFFICULTY_ADJUSTMENT {
+		adjustment = -MAX_DIFFICULTY_ADJUSTMENT
+	}
+	difficulty := int(last.difficulty) + adjustment
+	if difficulty < MIN_DIFFICULTY {
+		difficulty = MIN_DIFFICULTY
+	}
+	if difficulty > MAX_DIFFICULTY {
+		difficulty = MAX_DIFFICULTY
+	}
+	return uint32(difficulty)
+}
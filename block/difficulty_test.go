@@ -0,0 +1,58 @@
+package block
+
+import (
+	"testing"
+	"time"
+)
+
+// headers after the genesis block, every one spacing after the previous one
+// and all at difficulty
+func testHeaders(n int, spacing time.Duration, difficulty uint32) []*BlockHeader {
+	headers := []*BlockHeader{GenesisBlock().Header()}
+	start := time.Now().Add(-time.Duration(n) * spacing).UnixNano()
+	for i := 1; i < n; i++ {
+		headers = append(headers, &BlockHeader{
+			height:     uint64(i),
+			timestamp:  start + int64(i)*int64(spacing),
+			difficulty: difficulty,
+		})
+	}
+	return headers
+}
+
+func TestNextDifficulty(t *testing.T) {
+	tests := []struct {
+		name       string
+		height     int
+		spacing    time.Duration
+		difficulty uint32
+		want       uint32
+	}{
+		{"first window", DIFFICULTY_ADJUSTMENT_INTERVAL, time.Second, INITIAL_DIFFICULTY, INITIAL_DIFFICULTY},
+		{"between retargets", 2*DIFFICULTY_ADJUSTMENT_INTERVAL + 3, time.Second, 20, 20},
+		{"on target", 2 * DIFFICULTY_ADJUSTMENT_INTERVAL, TARGET_BLOCK_TIME, 20, 20},
+		{"twice as fast", 2 * DIFFICULTY_ADJUSTMENT_INTERVAL, TARGET_BLOCK_TIME / 2, 20, 21},
+		{"twice as slow", 2 * DIFFICULTY_ADJUSTMENT_INTERVAL, 2 * TARGET_BLOCK_TIME, 20, 19},
+		{"much faster", 2 * DIFFICULTY_ADJUSTMENT_INTERVAL, TARGET_BLOCK_TIME / 100, 20, 20 + MAX_DIFFICULTY_ADJUSTMENT},
+		{"much slower", 2 * DIFFICULTY_ADJUSTMENT_INTERVAL, 100 * TARGET_BLOCK_TIME, 20, 20 - MAX_DIFFICULTY_ADJUSTMENT},
+		{"minimum", 2 * DIFFICULTY_ADJUSTMENT_INTERVAL, 100 * TARGET_BLOCK_TIME, MIN_DIFFICULTY, MIN_DIFFICULTY},
+		{"maximum", 2 * DIFFICULTY_ADJUSTMENT_INTERVAL, time.Millisecond, MAX_DIFFICULTY, MAX_DIFFICULTY},
+	}
+	for _, tt := range tests {
+		headers := testHeaders(tt.height, tt.spacing, tt.difficulty)
+		if got := NextHeaderDifficulty(headers); got != tt.want {
+			t.Errorf("%s: difficulty %d, want %d", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestNextDifficultyBlocksMatchHeaders(t *testing.T) {
+	headers := testHeaders(2*DIFFICULTY_ADJUSTMENT_INTERVAL, TARGET_BLOCK_TIME/2, 20)
+	blocks := make([]*Block, len(headers))
+	for i, h := range headers {
+		blocks[i] = &Block{header: *h}
+	}
+	if a, b := NextDifficulty(blocks), NextHeaderDifficulty(headers); a != b {
+		t.Errorf("blocks give %d, headers give %d", a, b)
+	}
+}
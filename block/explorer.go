@@ -0,0 +1,157 @@
+package block
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+)
+
+const (
+	// most blocks returned by Blocks and LatestBlocks
+	MAX_BLOCKS_PAGE = 100
+)
+
+// heights of the blocks and locations of the transactions on the chain,
+// kept in step with it like the addressIndex
+type blockIndex struct {
+	byHash map[[32]byte]uint64
+	byTx   map[[32]byte]txLocation
+}
+
+func newBlockIndex() *blockIndex {
+	return &blockIndex{make(map[[32]byte]uint64), make(map[[32]byte]txLocation)}
+}
+
+func blockIndexOf(blocks []*Block) *blockIndex {
+	ix := newBlockIndex()
+	for _, b := range blocks {
+		ix.add(b)
+	}
+	return ix
+}
+
+func (ix *blockIndex) add(b *Block) {
+	ix.byHash[b.Hash()] = b.header.height
+	for i, t := range b.transactions {
+		ix.byTx[t.ID()] = txLocation{b.header.height, i}
+	}
+}
+
+func (ix *blockIndex) remove(b *Block) {
+	delete(ix.byHash, b.Hash())
+	for _, t := range b.transactions {
+		if loc, ok := ix.byTx[t.ID()]; ok && loc.height == b.header.height {
+			delete(ix.byTx, t.ID())
+		}
+	}
+}
+
+// block at height, nil past the tip
+func (bc *Blockchain) BlockByHeight(height uint64) *Block {
+	bc.mux.RLock()
+	defer bc.mux.RUnlock()
+	if height >= uint64(len(bc.chain)) {
+		return nil
+	}
+	return bc.chain[height]
+}
+
+// block with the given hash, nil if it isn't on the chain
+func (bc *Blockchain) BlockByHash(hash [32]byte) *Block {
+	bc.mux.RLock()
+	defer bc.mux.RUnlock()
+	height, ok := bc.blocks.byHash[hash]
+	if !ok {
+		return nil
+	}
+	return bc.chain[height]
+}
+
+// up to limit blocks starting at height from, oldest first
+func (bc *Blockchain) Blocks(from uint64, limit int) []*Block {
+	if limit <= 0 || limit > MAX_BLOCKS_PAGE {
+		limit = MAX_BLOCKS_PAGE
+	}
+	bc.mux.RLock()
+	defer bc.mux.RUnlock()
+	blocks := make([]*Block, 0)
+	for h := from; h < uint64(len(bc.chain)) && len(blocks) < limit; h++ {
+		blocks = append(blocks, bc.chain[h])
+	}
+	return blocks
+}
+
+// the last n blocks, newest first
+func (bc *Blockchain) LatestBlocks(n int) []*Block {
+	if n <= 0 || n > MAX_BLOCKS_PAGE {
+		n = MAX_BLOCKS_PAGE
+	}
+	bc.mux.RLock()
+	defer bc.mux.RUnlock()
+	blocks := make([]*Block, 0, n)
+	for h := len(bc.chain) - 1; h >= 0 && len(blocks) < n; h-- {
+		blocks = append(blocks, bc.chain[h])
+	}
+	return blocks
+}
+
+// mined or pending transaction by id together with the block holding it,
+// nil if it is unknown
+func (bc *Blockchain) FindTransaction(id [32]byte) *TransactionInfo {
+	bc.mux.RLock()
+	defer bc.mux.RUnlock()
+	if loc, ok := bc.blocks.byTx[id]; ok {
+		b := bc.chain[loc.height]
+		header := b.header
+		return &TransactionInfo{
+			Transaction:   b.transactions[loc.index],
+			Height:        loc.height,
+			BlockHash:     b.Hash(),
+			Confirmations: uint64(len(bc.chain)) - loc.height,
+			Header:        &header,
+		}
+	}
+	if t, ok := bc.mempool.Get(id); ok {
+		return &TransactionInfo{Transaction: t, Pending: true}
+	}
+	return nil
+}
+
+// where the chain stands
+type ChainSummary struct {
+	Height  uint64
+	TipHash [32]byte
+	// difficulty of the tip and the one the next block needs
+	Difficulty     uint32
+	NextDifficulty uint32
+	Timestamp      int64
+	Work           *big.Int
+	MempoolSize    int
+}
+
+func (bc *Blockchain) Summary() *ChainSummary {
+	bc.mux.RLock()
+	defer bc.mux.RUnlock()
+	tip := bc.lastBlock()
+	return &ChainSummary{
+		Height:         tip.header.height,
+		TipHash:        tip.Hash(),
+		Difficulty:     tip.header.difficulty,
+		NextDifficulty: NextDifficulty(bc.chain),
+		Timestamp:      tip.header.timestamp,
+		Work:           new(big.Int).Set(bc.work),
+		MempoolSize:    bc.mempool.Len(),
+	}
+}
+
+func (s *ChainSummary) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Height         uint64 `json:"height"`
+		TipHash        string `json:"tipHash"`
+		Difficulty     uint32 `json:"difficulty"`
+		NextDifficulty uint32 `json:"nextDifficulty"`
+		Timestamp      int64  `json:"timestamp"`
+		Work           string `json:"work"`
+		MempoolSize    int    `json:"mempoolSize"`
+	}{s.Height, fmt.Sprintf("%x", s.TipHash), s.Difficulty, s.NextDifficulty, s.Timestamp, s.Work.String(), s.MempoolSize})
+}
@@ -0,0 +1,138 @@
+package block
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/nazeemnato/stonkcoin/utils"
+)
+
+func TestExplorerLookups(t *testing.T) {
+	policy := DefaultMonetaryPolicy()
+	policy.CoinbaseMaturity = 1
+	ka, a := testKey(t)
+	_, b := testKey(t)
+	A, err := NewBlockchainWithConfig(a, 0, Config{Policy: policy, MiningWorkers: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer A.Close()
+	add := func(tx *Transaction) {
+		t.Helper()
+		if err := A.AddTransaction(a, b, tx.amount, tx.fee, tx.nonce, tx.senderPublicKey, tx.signature); err != nil {
+			t.Fatal(err)
+		}
+	}
+	A.Mining()
+	A.Mining()
+	mined := testSignedTransfer(ka, b, utils.COIN, 0, 0)
+	add(mined)
+	A.Mining()
+	pending := testSignedTransfer(ka, b, utils.COIN, 0, 1)
+	add(pending)
+	chain := A.Chain()
+
+	for h, blk := range chain {
+		if got := A.BlockByHeight(uint64(h)); got != blk {
+			t.Errorf("block at height %d is not the chain's", h)
+		}
+		if got := A.BlockByHash(blk.Hash()); got != blk {
+			t.Errorf("block %x not found by hash", blk.Hash())
+		}
+	}
+	if A.BlockByHeight(uint64(len(chain))) != nil {
+		t.Error("found a block past the tip")
+	}
+	if A.BlockByHash([32]byte{1}) != nil {
+		t.Error("found a block by an unknown hash")
+	}
+
+	pages := []struct {
+		name   string
+		from   uint64
+		limit  int
+		height []uint64
+	}{
+		{"all", 0, 0, []uint64{0, 1, 2, 3}},
+		{"from the middle", 2, 10, []uint64{2, 3}},
+		{"limited", 1, 2, []uint64{1, 2}},
+		{"past the tip", 4, 10, []uint64{}},
+	}
+	for _, tt := range pages {
+		heights := make([]uint64, 0)
+		for _, blk := range A.Blocks(tt.from, tt.limit) {
+			heights = append(heights, blk.header.height)
+		}
+		if !reflect.DeepEqual(heights, tt.height) {
+			t.Errorf("%s: heights %v, want %v", tt.name, heights, tt.height)
+		}
+	}
+	latest := A.LatestBlocks(2)
+	if len(latest) != 2 || latest[0] != chain[3] || latest[1] != chain[2] {
+		t.Error("latest blocks are not the last two, newest first")
+	}
+	if n := len(A.LatestBlocks(0)); n != len(chain) {
+		t.Errorf("%d latest blocks, want the whole chain of %d", n, len(chain))
+	}
+
+	info := A.FindTransaction(mined.ID())
+	if info == nil || info.Pending || info.Height != 3 || info.BlockHash != chain[3].Hash() || info.Confirmations != 1 {
+		t.Fatalf("mined transfer found as %+v, want it in block 3", info)
+	}
+	if info.Header == nil || info.Header.height != 3 {
+		t.Error("mined transfer comes without its block header")
+	}
+	if info := A.FindTransaction(pending.ID()); info == nil || !info.Pending {
+		t.Errorf("pending transfer found as %+v", info)
+	}
+	if A.FindTransaction([32]byte{1}) != nil {
+		t.Error("found an unknown transaction")
+	}
+
+	summary := A.Summary()
+	if summary.Height != 3 || summary.TipHash != chain[3].Hash() || summary.MempoolSize != 1 {
+		t.Errorf("summary %+v, want height 3 with one pending", summary)
+	}
+	if summary.Work.Cmp(ChainWork(chain)) != 0 {
+		t.Errorf("summary work %s, want %s", summary.Work, ChainWork(chain))
+	}
+
+	// after a reorg the blocks and transactions of the old branch are gone
+	B, err := NewBlockchainWithConfig(b, 0, Config{Policy: policy, MiningWorkers: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer B.Close()
+	for i := 0; i < 5; i++ {
+		B.Mining()
+	}
+	if err := A.ReplaceChain(B.Chain()); err != nil {
+		t.Fatal(err)
+	}
+	for _, blk := range chain[1:] {
+		if A.BlockByHash(blk.Hash()) != nil {
+			t.Errorf("block %d of the old branch still found", blk.header.height)
+		}
+	}
+	if info := A.FindTransaction(mined.ID()); info != nil {
+		t.Errorf("transfer of the old branch found as %+v", info)
+	}
+	replaced := B.Chain()
+	for _, blk := range replaced {
+		if A.BlockByHash(blk.Hash()) == nil {
+			t.Errorf("block %d of the new branch not found", blk.header.height)
+		}
+		for _, tx := range blk.transactions {
+			if info := A.FindTransaction(tx.ID()); info == nil || info.Height != blk.header.height {
+				t.Errorf("transaction %x of block %d not found", tx.ID(), blk.header.height)
+			}
+		}
+	}
+	if !reflect.DeepEqual(A.blocks, blockIndexOf(replaced)) {
+		t.Error("block index differs from one built from the new chain")
+	}
+	summary = A.Summary()
+	if summary.Height != 5 || summary.TipHash != replaced[5].Hash() || summary.Work.Cmp(ChainWork(replaced)) != 0 {
+		t.Errorf("summary %+v after the reorg, want the new tip", summary)
+	}
+}
@@ -0,0 +1,176 @@
+package block
+
+import (
+	"container/heap"
+	"encoding/json"
+	"sort"
+
+	"github.com/nazeemnato/stonkcoin/utils"
+)
+
+const (
+	// most transactions in a block, coinbase included
+	MAX_BLOCK_TRANSACTIONS = 1000
+	// most bytes of transactions in a block
+	MAX_BLOCK_SIZE = 1 << 20
+	// recent blocks fee estimates look at
+	FEE_ESTIMATE_BLOCKS = 10
+)
+
+// fee per 1000 bytes, saturating instead of overflowing
+func FeeRate(fee utils.Amount, size int) utils.Amount {
+	if size <= 0 {
+		return 0
+	}
+	if fee > utils.MAX_AMOUNT/1000 {
+		return utils.MAX_AMOUNT / utils.Amount(size)
+	}
+	return fee * 1000 / utils.Amount(size)
+}
+
+// total fees of the transfers in transactions
+func totalFees(transactions []*Transaction) (utils.Amount, error) {
+	var fees utils.Amount
+	for _, t := range transactions {
+		var err error
+		if fees, err = fees.Add(t.fee); err != nil {
+			return 0, err
+		}
+	}
+	return fees, nil
+}
+
+// bytes of transactions in a block
+func transactionsSize(transactions []*Transaction) int {
+	size := 0
+	for _, t := range transactions {
+		size += t.Size()
+	}
+	return size
+}
+
+// pending transactions of one sender in nonce order, ranked by the fee rate
+// of the first one since the rest can't be mined before it
+type senderQueue struct {
+	transactions []*Transaction
+	rate         utils.Amount
+	order        int
+}
+
+type senderHeap []*senderQueue
+
+func (h senderHeap) Len() int { return len(h) }
+func (h senderHeap) Less(i, j int) bool {
+	if h[i].rate != h[j].rate {
+		return h[i].rate > h[j].rate
+	}
+	// first come first served on equal fees
+	return h[i].order < h[j].order
+}
+func (h senderHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *senderHeap) Push(x interface{}) { *h = append(*h, x.(*senderQueue)) }
+func (h *senderHeap) Pop() interface{} {
+	old := *h
+	q := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return q
+}
+
+// pick the pool transactions with the highest fee rate that fit in count
+// transactions and size bytes. a sender's transactions stay in nonce order,
+// so when one doesn't fit the ones after it are left out as well
+func selectTransactions(pool []*Transaction, count int, size int) []*Transaction {
+	queues := make(map[string]*senderQueue)
+	h := make(senderHeap, 0)
+	for i, t := range pool {
+		q, ok := queues[t.queueKey()]
+		if !ok {
+			q = &senderQueue{order: i}
+			queues[t.queueKey()] = q
+			h = append(h, q)
+		}
+		q.transactions = append(q.transactions, t)
+	}
+	for _, q := range h {
+		q.rate = q.transactions[0].FeeRate()
+	}
+	heap.Init(&h)
+	selected := make([]*Transaction, 0)
+	for h.Len() > 0 && len(selected) < count {
+		q := heap.Pop(&h).(*senderQueue)
+		t := q.transactions[0]
+		if t.Size() > size {
+			continue
+		}
+		c := *t
+		selected = append(selected, &c)
+		size -= t.Size()
+		if q.transactions = q.transactions[1:]; len(q.transactions) > 0 {
+			q.rate = q.transactions[0].FeeRate()
+			heap.Push(&h, q)
+		}
+	}
+	return selected
+}
+
+// fee rates paid in recent blocks, per 1000 bytes
+type FeeEstimate struct {
+	Blocks       int
+	Transactions int
+	Low          utils.Amount
+	Medium       utils.Amount
+	High         utils.Amount
+	// medium rate applied to the average transaction size
+	Fee utils.Amount
+}
+
+// estimate fees from the transfers in the last FEE_ESTIMATE_BLOCKS blocks
+func (bc *Blockchain) EstimateFee() *FeeEstimate {
+	bc.mux.RLock()
+	defer bc.mux.RUnlock()
+	from := len(bc.chain) - FEE_ESTIMATE_BLOCKS
+	if from < 1 {
+		from = 1
+	}
+	estimate := &FeeEstimate{Blocks: len(bc.chain) - from}
+	rates := make([]utils.Amount, 0)
+	size := 0
+	for _, b := range bc.chain[from:] {
+		for _, t := range b.transactions {
+			if t.IsCoinbase() {
+				continue
+			}
+			rates = append(rates, t.FeeRate())
+			size += t.Size()
+		}
+	}
+	estimate.Transactions = len(rates)
+	if len(rates) == 0 {
+		return estimate
+	}
+	sort.Slice(rates, func(i, j int) bool { return rates[i] < rates[j] })
+	percentile := func(p int) utils.Amount {
+		return rates[(len(rates)-1)*p/100]
+	}
+	estimate.Low = percentile(25)
+	estimate.Medium = percentile(50)
+	estimate.High = percentile(90)
+	average := size / len(rates)
+	if estimate.Medium > utils.MAX_AMOUNT/utils.Amount(average) {
+		estimate.Fee = utils.MAX_AMOUNT
+	} else {
+		estimate.Fee = estimate.Medium * utils.Amount(average) / 1000
+	}
+	return estimate
+}
+
+func (e *FeeEstimate) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Blocks       int          `json:"blocks"`
+		Transactions int          `json:"transactions"`
+		Low          utils.Amount `json:"low"`
+		Medium       utils.Amount `json:"medium"`
+		High         utils.Amount `json:"high"`
+		Fee          utils.Amount `json:"fee"`
+	}{e.Blocks, e.Transactions, e.Low, e.Medium, e.High, e.Fee})
+}
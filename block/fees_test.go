@@ -0,0 +1,91 @@
+package block
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/nazeemnato/stonkcoin/utils"
+)
+
+func sameTransactions(t *testing.T, name string, got, want []*Transaction) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Errorf("%s: selected %d transactions, want %d", name, len(got), len(want))
+		return
+	}
+	for i := range got {
+		if got[i].ID() != want[i].ID() {
+			t.Errorf("%s: transaction %d is %s/%d, want %s/%d", name, i, got[i].senderAddress, got[i].nonce, want[i].senderAddress, want[i].nonce)
+		}
+	}
+}
+
+func TestSelectTransactions(t *testing.T) {
+	a0 := testTransfer("a", 0, 1)
+	a1 := testTransfer("a", 1, 1000)
+	b0 := testTransfer("b", 0, 100)
+	c0 := testTransfer("c", 0, 10)
+	// pays the most but doesn't fit next to anything else
+	big := testTransfer(strings.Repeat("x", 1000), 0, 1000000)
+	size := a0.Size() + b0.Size() + c0.Size()
+	tests := []struct {
+		name  string
+		pool  []*Transaction
+		count int
+		size  int
+		want  []*Transaction
+	}{
+		{"empty", nil, 10, MAX_BLOCK_SIZE, []*Transaction{}},
+		{"fee rate across senders", []*Transaction{a0, c0, b0}, 10, MAX_BLOCK_SIZE, []*Transaction{b0, c0, a0}},
+		// a1 pays the most but has to wait for a0
+		{"nonce order", []*Transaction{a0, a1, c0}, 10, MAX_BLOCK_SIZE, []*Transaction{c0, a0, a1}},
+		{"count limit", []*Transaction{a0, c0, b0}, 2, MAX_BLOCK_SIZE, []*Transaction{b0, c0}},
+		{"size limit", []*Transaction{a0, c0, b0}, 10, b0.Size() + c0.Size(), []*Transaction{b0, c0}},
+		{"oversized", []*Transaction{big, a0, c0, b0}, 10, size, []*Transaction{b0, c0, a0}},
+	}
+	for _, tt := range tests {
+		sameTransactions(t, tt.name, selectTransactions(tt.pool, tt.count, tt.size), tt.want)
+	}
+}
+
+// chain of blocks carrying one transfer each, paying the given fees
+func testFeeChain(fees ...utils.Amount) *Blockchain {
+	chain := []*Block{GenesisBlock()}
+	for i, fee := range fees {
+		height := uint64(i + 1)
+		coinbase := NewCoinbaseTransaction("miner", MINING_REWARD+fee, height)
+		// same sized senders and fees of as many digits keep the sizes equal,
+		// amounts are written without trailing zeros
+		transfer := testTransfer(string(rune('a'+i)), 0, fee)
+		chain = append(chain, NewBlock(height, chain[i].Hash(), []*Transaction{coinbase, transfer}, 0))
+	}
+	return &Blockchain{chain: chain}
+}
+
+func TestEstimateFee(t *testing.T) {
+	size := testTransfer("a", 0, 100001).Size()
+	rate := func(fee utils.Amount) utils.Amount { return FeeRate(fee, size) }
+
+	empty := testFeeChain().EstimateFee()
+	if *empty != (FeeEstimate{}) {
+		t.Errorf("estimate %+v without transfers, want zero", *empty)
+	}
+
+	// the first block is older than FEE_ESTIMATE_BLOCKS and left out
+	fees := []utils.Amount{900001}
+	for i := 1; i <= FEE_ESTIMATE_BLOCKS; i++ {
+		fees = append(fees, utils.Amount(100001+i*10000))
+	}
+	full := testFeeChain(fees...).EstimateFee()
+	want := FeeEstimate{
+		Blocks:       FEE_ESTIMATE_BLOCKS,
+		Transactions: FEE_ESTIMATE_BLOCKS,
+		Low:          rate(130001),
+		Medium:       rate(150001),
+		High:         rate(190001),
+		Fee:          rate(150001) * utils.Amount(size) / 1000,
+	}
+	if *full != want {
+		t.Errorf("estimate %+v, want %+v", *full, want)
+	}
+}
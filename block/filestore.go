@@ -0,0 +1,240 @@
+package block
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/nazeemnato/stonkcoin/utils"
+)
+
+const (
+	BLOCKS_FILE       = "blocks.dat"
+	TRANSACTIONS_FILE = "mempool.json"
+	// length (4 bytes) + crc32 (4 bytes)
+	recordHeaderSize = 8
+	maxRecordSize    = 32 << 20
+)
+
+// append only file store
+//
+// every block is written as one record: big endian payload length, crc32 of
+// the payload and the block json. a record that was cut short by a crash is
+// dropped (and truncated away) on the next load, so the chain on disk is
+// always a valid prefix of what was written.
+type FileStore struct {
+	dir    string
+	blocks blockFile
+	// end of the last complete record
+	size int64
+	// a failed append could not be cut off again, the next one does it
+	torn bool
+	mux  sync.Mutex
+}
+
+// the parts of *os.File the store uses
+type blockFile interface {
+	io.ReadWriteSeeker
+	Truncate(size int64) error
+	Sync() error
+	Close() error
+}
+
+// open (or create) a file store inside dir
+func NewFileStore(dir string) (*FileStore, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(filepath.Join(dir, BLOCKS_FILE), os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &FileStore{dir: dir, blocks: f, size: info.Size()}, nil
+}
+
+func (fs *FileStore) LoadBlocks() ([]*Block, error) {
+	fs.mux.Lock()
+	defer fs.mux.Unlock()
+	if _, err := fs.blocks.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	r := bufio.NewReader(fs.blocks)
+	blocks := make([]*Block, 0)
+	var offset int64
+	for {
+		payload, err := readRecord(r)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			// torn or corrupted write, keep everything before it
+			log.Printf("Dropping damaged block record at offset %d: %s\n", offset, err)
+			if err := fs.blocks.Truncate(offset); err != nil {
+				return nil, err
+			}
+			fs.torn = false
+			break
+		}
+		var b Block
+		if err := json.Unmarshal(payload, &b); err != nil {
+			return nil, fmt.Errorf("block %d: %w", len(blocks), err)
+		}
+		blocks = append(blocks, &b)
+		offset += int64(recordHeaderSize + len(payload))
+	}
+	if _, err := fs.blocks.Seek(offset, io.SeekStart); err != nil {
+		return nil, err
+	}
+	fs.size = offset
+	return blocks, nil
+}
+
+func (fs *FileStore) AppendBlock(b *Block) error {
+	record, err := blockRecord(b)
+	if err != nil {
+		return err
+	}
+	fs.mux.Lock()
+	defer fs.mux.Unlock()
+	if fs.torn {
+		if err := fs.blocks.Truncate(fs.size); err != nil {
+			return err
+		}
+		fs.torn = false
+	}
+	if _, err := fs.blocks.Seek(fs.size, io.SeekStart); err != nil {
+		return err
+	}
+	if _, err := fs.blocks.Write(record); err != nil {
+		return fs.discardAppend(err)
+	}
+	if err := fs.blocks.Sync(); err != nil {
+		return fs.discardAppend(err)
+	}
+	fs.size += int64(len(record))
+	return nil
+}
+
+// cut off what a failed append left behind, the chain doesn't hold the block
+// so it mustn't be loaded back or have the next block written after it
+func (fs *FileStore) discardAppend(err error) error {
+	if terr := fs.blocks.Truncate(fs.size); terr != nil {
+		fs.torn = true
+		return fmt.Errorf("%w (and could not truncate it away: %s)", err, terr)
+	}
+	return err
+}
+
+// write the new chain next to the old one and rename it into place, a crash
+// leaves either the old or the new chain on disk
+func (fs *FileStore) ReplaceBlocks(blocks []*Block) error {
+	data := make([]byte, 0)
+	for _, b := range blocks {
+		record, err := blockRecord(b)
+		if err != nil {
+			return err
+		}
+		data = append(data, record...)
+	}
+	fs.mux.Lock()
+	defer fs.mux.Unlock()
+	path := filepath.Join(fs.dir, BLOCKS_FILE)
+	if err := utils.WriteFileAtomic(path, data); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_RDWR, 0600)
+	if err != nil {
+		return err
+	}
+	fs.blocks.Close()
+	fs.blocks = f
+	fs.size = int64(len(data))
+	fs.torn = false
+	return nil
+}
+
+func (fs *FileStore) LoadTransactions() ([]*PendingTransaction, error) {
+	fs.mux.Lock()
+	defer fs.mux.Unlock()
+	pending := make([]*PendingTransaction, 0)
+	m, err := os.ReadFile(filepath.Join(fs.dir, TRANSACTIONS_FILE))
+	if errors.Is(err, os.ErrNotExist) {
+		return pending, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(m, &pending); err != nil {
+		return nil, err
+	}
+	return pending, nil
+}
+
+// the pool is rewritten as a whole and swapped in with a rename, the
+// blockchain batches the writes, see MEMPOOL_SAVE_DELAY
+func (fs *FileStore) SaveTransactions(pending []*PendingTransaction) error {
+	m, err := json.Marshal(pending)
+	if err != nil {
+		return err
+	}
+	fs.mux.Lock()
+	defer fs.mux.Unlock()
+	return utils.WriteFileAtomic(filepath.Join(fs.dir, TRANSACTIONS_FILE), m)
+}
+
+func (fs *FileStore) Close() error {
+	fs.mux.Lock()
+	defer fs.mux.Unlock()
+	return fs.blocks.Close()
+}
+
+// length prefixed, checksummed record holding the block json
+func blockRecord(b *Block) ([]byte, error) {
+	payload, err := b.MarshalJSON()
+	if err != nil {
+		return nil, err
+	}
+	record := make([]byte, recordHeaderSize+len(payload))
+	binary.BigEndian.PutUint32(record[0:4], uint32(len(payload)))
+	binary.BigEndian.PutUint32(record[4:8], crc32.ChecksumIEEE(payload))
+	copy(record[recordHeaderSize:], payload)
+	return record, nil
+}
+
+// read one length prefixed, checksummed record
+func readRecord(r *bufio.Reader) ([]byte, error) {
+	header := make([]byte, recordHeaderSize)
+	n, err := io.ReadFull(r, header)
+	if err == io.EOF {
+		return nil, io.EOF
+	}
+	if err != nil {
+		return nil, fmt.Errorf("short record header (%d bytes)", n)
+	}
+	length := binary.BigEndian.Uint32(header[0:4])
+	checksum := binary.BigEndian.Uint32(header[4:8])
+	if length > maxRecordSize {
+		return nil, fmt.Errorf("record too large (%d bytes)", length)
+	}
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return nil, errors.New("short record payload")
+	}
+	if crc32.ChecksumIEEE(payload) != checksum {
+		return nil, errors.New("checksum mismatch")
+	}
+	return payload, nil
+}
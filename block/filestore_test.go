@@ -0,0 +1,76 @@
+package block
+
+import (
+	"errors"
+	"testing"
+)
+
+// file whose next write stops halfway or whose next sync fails
+type failingFile struct {
+	blockFile
+	failWrite bool
+	failSync  bool
+}
+
+func (f *failingFile) Write(p []byte) (int, error) {
+	if f.failWrite {
+		f.failWrite = false
+		n, _ := f.blockFile.Write(p[:len(p)/2])
+		return n, errors.New("disk full")
+	}
+	return f.blockFile.Write(p)
+}
+
+func (f *failingFile) Sync() error {
+	if f.failSync {
+		f.failSync = false
+		return errors.New("i/o error")
+	}
+	return f.blockFile.Sync()
+}
+
+func TestFileStoreFailedAppend(t *testing.T) {
+	tests := []struct {
+		name string
+		fail func(f *failingFile)
+	}{
+		{"short write", func(f *failingFile) { f.failWrite = true }},
+		{"sync", func(f *failingFile) { f.failSync = true }},
+	}
+	for _, tt := range tests {
+		dir := t.TempDir()
+		fs, err := NewFileStore(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f := &failingFile{blockFile: fs.blocks}
+		fs.blocks = f
+		genesis := GenesisBlock()
+		lost := NewBlock(1, genesis.Hash(), nil, genesis.Difficulty())
+		next := NewBlock(1, genesis.Hash(), []*Transaction{NewCoinbaseTransaction("a", 1, 1)}, genesis.Difficulty())
+		if err := fs.AppendBlock(genesis); err != nil {
+			t.Fatal(err)
+		}
+		tt.fail(f)
+		if err := fs.AppendBlock(lost); err == nil {
+			t.Fatalf("%s: failed append reported no error", tt.name)
+		}
+		if err := fs.AppendBlock(next); err != nil {
+			t.Fatalf("%s: %s", tt.name, err)
+		}
+		fs.Close()
+
+		reopened, err := NewFileStore(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		blocks, err := reopened.LoadBlocks()
+		reopened.Close()
+		if err != nil {
+			t.Fatalf("%s: %s", tt.name, err)
+		}
+		if len(blocks) != 2 || blocks[0].Hash() != genesis.Hash() || blocks[1].Hash() != next.Hash() {
+			t.Errorf("%s: loaded %d blocks, want genesis and the block appended after the failure", tt.name, len(blocks))
+		}
+	}
+}
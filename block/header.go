@@ -0,0 +1,155 @@
+package block
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+)
+
+const (
+	BLOCK_VERSION = 1
+	// version, height, prevHash, merkleRoot, timestamp, difficulty, nonce
+	HEADER_SIZE = 4 + 8 + 32 + 32 + 8 + 4 + 8
+)
+
+// fixed size part of a block, its hash is the block hash and the only thing
+// proof of work is done on. transactions are committed through merkleRoot
+type BlockHeader struct {
+	version    uint32
+	height     uint64
+	prevHash   [32]byte
+	merkleRoot [32]byte
+	timestamp  int64
+	difficulty uint32
+	nonce      uint64
+}
+
+// big endian binary serialisation, always HEADER_SIZE bytes
+func (h *BlockHeader) Bytes() []byte {
+	buf := make([]byte, HEADER_SIZE)
+	binary.BigEndian.PutUint32(buf[0:4], h.version)
+	binary.BigEndian.PutUint64(buf[4:12], h.height)
+	copy(buf[12:44], h.prevHash[:])
+	copy(buf[44:76], h.merkleRoot[:])
+	binary.BigEndian.PutUint64(buf[76:84], uint64(h.timestamp))
+	binary.BigEndian.PutUint32(buf[84:88], h.difficulty)
+	binary.BigEndian.PutUint64(buf[88:96], h.nonce)
+	return buf
+}
+
+// create hash of header
+func (h *BlockHeader) Hash() [32]byte {
+	return sha256.Sum256(h.Bytes())
+}
+
+// check that the hash meets the header's own difficulty
+func (h *BlockHeader) ValidProof() bool {
+	return LeadingZeroBits(h.Hash()) >= int(h.difficulty)
+}
+
+func (h *BlockHeader) Version() uint32 {
+	return h.version
+}
+
+func (h *BlockHeader) Height() uint64 {
+	return h.height
+}
+
+func (h *BlockHeader) PrevHash() [32]byte {
+	return h.prevHash
+}
+
+func (h *BlockHeader) MerkleRoot() [32]byte {
+	return h.merkleRoot
+}
+
+func (h *BlockHeader) Timestamp() int64 {
+	return h.timestamp
+}
+
+func (h *BlockHeader) Difficulty() uint32 {
+	return h.difficulty
+}
+
+func (h *BlockHeader) Nonce() uint64 {
+	return h.nonce
+}
+
+// print function for header
+func (h *BlockHeader) Print() {
+	fmt.Printf("version: %d\n", h.version)
+	fmt.Printf("height: %d\n", h.height)
+	fmt.Printf("prevHash: %x\n", h.prevHash)
+	fmt.Printf("merkleRoot: %x\n", h.merkleRoot)
+	fmt.Printf("timestamp: %d\n", h.timestamp)
+	fmt.Printf("difficulty: %d\n", h.difficulty)
+	fmt.Printf("nonce: %d\n", h.nonce)
+}
+
+// json form of a header, blocks embed it next to their transactions
+type headerJSON struct {
+	Hash       string `json:"hash"`
+	Version    uint32 `json:"version"`
+	Height     uint64 `json:"height"`
+	PrevHash   string `json:"prevHash"`
+	MerkleRoot string `json:"merkleRoot"`
+	Timestamp  int64  `json:"timestamp"`
+	Difficulty uint32 `json:"difficulty"`
+	Nonce      uint64 `json:"nonce"`
+}
+
+func (h *BlockHeader) toJSON() *headerJSON {
+	return &headerJSON{
+		Hash:       fmt.Sprintf("%x", h.Hash()),
+		Version:    h.version,
+		Height:     h.height,
+		PrevHash:   fmt.Sprintf("%x", h.prevHash),
+		MerkleRoot: fmt.Sprintf("%x", h.merkleRoot),
+		Timestamp:  h.timestamp,
+		Difficulty: h.difficulty,
+		Nonce:      h.nonce,
+	}
+}
+
+// the hash is derived, so it is not read back
+func (h *BlockHeader) fromJSON(v *headerJSON) error {
+	if err := decodeHash(v.PrevHash, &h.prevHash); err != nil {
+		return fmt.Errorf("invalid prevHash %q", v.PrevHash)
+	}
+	if err := decodeHash(v.MerkleRoot, &h.merkleRoot); err != nil {
+		return fmt.Errorf("invalid merkleRoot %q", v.MerkleRoot)
+	}
+	h.version = v.Version
+	h.height = v.Height
+	h.timestamp = v.Timestamp
+	h.difficulty = v.Difficulty
+	h.nonce = v.Nonce
+	return nil
+}
+
+func (h *BlockHeader) MarshalJSON() ([]byte, error) {
+	return json.Marshal(h.toJSON())
+}
+
+func (h *BlockHeader) UnmarshalJSON(data []byte) error {
+	var v headerJSON
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	return h.fromJSON(&v)
+}
+
+// decode 64 hex characters into a hash
+func decodeHash(s string, hash *[32]byte) error {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		return err
+	}
+	if len(b) != 32 {
+		return fmt.Errorf("hash must be 32 bytes")
+	}
+	copy(hash[:], b)
+	return nil
+}
@@ -0,0 +1,232 @@
+package block
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/nazeemnato/stonkcoin/utils"
+)
+
+const (
+	HISTORY_PAGE_SIZE     = 50
+	HISTORY_MAX_PAGE_SIZE = 500
+
+	DIRECTION_IN   = "in"
+	DIRECTION_OUT  = "out"
+	DIRECTION_SELF = "self"
+)
+
+// where a transaction sits on the chain
+type txLocation struct {
+	height uint64
+	index  int
+}
+
+// confirmed transactions per address in chain order. it is only appended to
+// and trimmed at the tail, a reorg takes off the entries of the blocks that
+// left the chain
+type addressIndex struct {
+	entries map[string][]txLocation
+}
+
+func newAddressIndex() *addressIndex {
+	return &addressIndex{make(map[string][]txLocation)}
+}
+
+func addressIndexOf(blocks []*Block) *addressIndex {
+	ix := newAddressIndex()
+	for _, b := range blocks {
+		ix.add(b)
+	}
+	return ix
+}
+
+func (ix *addressIndex) add(b *Block) {
+	for i, t := range b.transactions {
+		for _, address := range t.addresses() {
+			ix.entries[address] = append(ix.entries[address], txLocation{b.header.height, i})
+		}
+	}
+}
+
+// undo add, b has to be the last block added
+func (ix *addressIndex) remove(b *Block) {
+	for _, t := range b.transactions {
+		for _, address := range t.addresses() {
+			entries := ix.entries[address]
+			for len(entries) > 0 && entries[len(entries)-1].height >= b.header.height {
+				entries = entries[:len(entries)-1]
+			}
+			if len(entries) == 0 {
+				delete(ix.entries, address)
+			} else {
+				ix.entries[address] = entries
+			}
+		}
+	}
+}
+
+// addresses a transaction involves, each once. inputs belong to the key that
+// signed them
+func (t *Transaction) addresses() []string {
+	seen := make(map[string]bool)
+	addresses := make([]string, 0, 2)
+	add := func(address string) {
+		if address != "" && address != MINING_SENDER && !seen[address] {
+			seen[address] = true
+			addresses = append(addresses, address)
+		}
+	}
+	add(t.senderAddress)
+	add(t.recipientAddress)
+	for _, in := range t.inputs {
+		if in.publicKey != nil {
+			add(utils.AddressFromPublicKey(in.publicKey))
+		}
+	}
+	for _, out := range t.outputs {
+		add(out.address)
+	}
+	return addresses
+}
+
+// whether the transaction pays address, takes money from it or both. paying
+// only yourself, change included, is self
+func (t *Transaction) direction(address string) string {
+	sent := !t.IsCoinbase() && t.senderAddress == address
+	for _, in := range t.inputs {
+		if in.publicKey != nil && utils.AddressFromPublicKey(in.publicKey) == address {
+			sent = true
+		}
+	}
+	received, others := false, false
+	if t.creditsAccount() {
+		if t.recipientAddress == address {
+			received = true
+		} else {
+			others = true
+		}
+	}
+	for _, out := range t.outputs {
+		if out.address == address {
+			received = true
+		} else {
+			others = true
+		}
+	}
+	switch {
+	case sent && received && !others:
+		return DIRECTION_SELF
+	case sent:
+		return DIRECTION_OUT
+	default:
+		return DIRECTION_IN
+	}
+}
+
+// transaction with where it stands on the chain, pending ones have no height
+type TransactionInfo struct {
+	Transaction   *Transaction
+	Pending       bool
+	Height        uint64
+	BlockHash     [32]byte
+	Confirmations uint64
+	// relative to the address of a History, empty otherwise
+	Direction string
+	// header of the containing block when looked up by id
+	Header *BlockHeader
+}
+
+func (e *TransactionInfo) MarshalJSON() ([]byte, error) {
+	status := "confirmed"
+	var height *uint64
+	var blockHash string
+	if e.Pending {
+		status = "pending"
+	} else {
+		height = &e.Height
+		blockHash = fmt.Sprintf("%x", e.BlockHash)
+	}
+	return json.Marshal(struct {
+		Transaction   *Transaction `json:"transaction"`
+		Status        string       `json:"status"`
+		Height        *uint64      `json:"height,omitempty"`
+		BlockHash     string       `json:"blockHash,omitempty"`
+		Confirmations uint64       `json:"confirmations"`
+		Direction     string       `json:"direction,omitempty"`
+		Block         *BlockHeader `json:"block,omitempty"`
+	}{e.Transaction, status, height, blockHash, e.Confirmations, e.Direction, e.Header})
+}
+
+// page of an address' transactions
+type History struct {
+	Address string
+	Entries []*TransactionInfo
+	// pending and confirmed transactions in total
+	Total  int
+	Offset int
+	Limit  int
+}
+
+func (h *History) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Address      string             `json:"address"`
+		Transactions []*TransactionInfo `json:"transactions"`
+		Total        int                `json:"total"`
+		Offset       int                `json:"offset"`
+		Limit        int                `json:"limit"`
+	}{h.Address, h.Entries, h.Total, h.Offset, h.Limit})
+}
+
+// transactions involving address, pending ones first and then confirmed
+// ones from the newest, skipping offset and returning at most limit. limit
+// falls back to HISTORY_PAGE_SIZE when it is out of range
+func (bc *Blockchain) History(address string, offset int, limit int) *History {
+	return bc.State().History(address, offset, limit)
+}
+
+// History, called with the lock held
+func (bc *Blockchain) history(address string, offset int, limit int) *History {
+	if offset < 0 {
+		offset = 0
+	}
+	if limit <= 0 || limit > HISTORY_MAX_PAGE_SIZE {
+		limit = HISTORY_PAGE_SIZE
+	}
+	pending := make([]*Transaction, 0)
+	for _, t := range bc.mempool.Transactions() {
+		for _, a := range t.addresses() {
+			if a == address {
+				pending = append(pending, t)
+				break
+			}
+		}
+	}
+	confirmed := bc.addresses.entries[address]
+	h := &History{
+		Address: address,
+		Entries: make([]*TransactionInfo, 0),
+		Total:   len(pending) + len(confirmed),
+		Offset:  offset,
+		Limit:   limit,
+	}
+	tip := uint64(len(bc.chain) - 1)
+	for i := offset; i < h.Total && len(h.Entries) < limit; i++ {
+		if i < len(pending) {
+			t := pending[i]
+			h.Entries = append(h.Entries, &TransactionInfo{Transaction: t, Pending: true, Direction: t.direction(address)})
+			continue
+		}
+		loc := confirmed[len(confirmed)-1-(i-len(pending))]
+		b := bc.chain[loc.height]
+		t := b.transactions[loc.index]
+		h.Entries = append(h.Entries, &TransactionInfo{
+			Transaction:   t,
+			Height:        loc.height,
+			BlockHash:     b.Hash(),
+			Confirmations: tip - loc.height + 1,
+			Direction:     t.direction(address),
+		})
+	}
+	return h
+}
@@ -0,0 +1,142 @@
+package block
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/nazeemnato/stonkcoin/utils"
+)
+
+func TestDirection(t *testing.T) {
+	tests := []struct {
+		name    string
+		t       *Transaction
+		address string
+		want    string
+	}{
+		{"sender", NewTransaction("a", "b", utils.COIN, 0, 0), "a", DIRECTION_OUT},
+		{"recipient", NewTransaction("a", "b", utils.COIN, 0, 0), "b", DIRECTION_IN},
+		{"to itself", NewTransaction("a", "a", utils.COIN, 0, 0), "a", DIRECTION_SELF},
+		{"coinbase", NewCoinbaseTransaction("a", utils.COIN, 1), "a", DIRECTION_IN},
+	}
+	for _, tt := range tests {
+		if got := tt.t.direction(tt.address); got != tt.want {
+			t.Errorf("%s: direction %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestHistory(t *testing.T) {
+	policy := DefaultMonetaryPolicy()
+	policy.CoinbaseMaturity = 1
+	ka, a := testKey(t)
+	_, b := testKey(t)
+	A, err := NewBlockchainWithConfig(a, 0, Config{Policy: policy, MiningWorkers: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer A.Close()
+	add := func(tx *Transaction) {
+		t.Helper()
+		if err := A.AddTransaction(a, b, tx.amount, tx.fee, tx.nonce, tx.senderPublicKey, tx.signature); err != nil {
+			t.Fatal(err)
+		}
+	}
+	A.Mining()
+	A.Mining()
+	sent := testSignedTransfer(ka, b, utils.COIN, 0, 0)
+	add(sent)
+	A.Mining()
+	pending := testSignedTransfer(ka, b, utils.COIN, 0, 1)
+	add(pending)
+
+	// pending first, then confirmed from the newest. the miner puts the
+	// coinbase last, so it comes ahead of the transfer in its block
+	coinbase := func(height int) [32]byte {
+		transactions := A.Chain()[height].transactions
+		return transactions[len(transactions)-1].ID()
+	}
+	h := A.History(a, 0, 0)
+	if h.Total != 5 || h.Limit != HISTORY_PAGE_SIZE {
+		t.Fatalf("%d transactions with limit %d, want 5 with %d", h.Total, h.Limit, HISTORY_PAGE_SIZE)
+	}
+	want := []struct {
+		id        [32]byte
+		pending   bool
+		height    uint64
+		direction string
+	}{
+		{pending.ID(), true, 0, DIRECTION_OUT},
+		{coinbase(3), false, 3, DIRECTION_IN},
+		{sent.ID(), false, 3, DIRECTION_OUT},
+		{coinbase(2), false, 2, DIRECTION_IN},
+		{coinbase(1), false, 1, DIRECTION_IN},
+	}
+	for i, e := range h.Entries {
+		w := want[i]
+		if e.Transaction.ID() != w.id || e.Pending != w.pending || e.Height != w.height || e.Direction != w.direction {
+			t.Errorf("entry %d is %x pending %v at %d %s, want %x pending %v at %d %s", i,
+				e.Transaction.ID(), e.Pending, e.Height, e.Direction, w.id, w.pending, w.height, w.direction)
+		}
+	}
+	if c := h.Entries[1].Confirmations; c != 1 {
+		t.Errorf("tip has %d confirmations, want 1", c)
+	}
+	if c := h.Entries[4].Confirmations; c != 3 {
+		t.Errorf("first block has %d confirmations, want 3", c)
+	}
+	if h := A.History(b, 0, 0); len(h.Entries) != 2 || h.Entries[0].Direction != DIRECTION_IN {
+		t.Errorf("recipient has %d transactions, want 2 incoming", len(h.Entries))
+	}
+
+	pages := []struct {
+		name    string
+		offset  int
+		limit   int
+		entries int
+		first   [32]byte
+	}{
+		{"first page", 0, 2, 2, pending.ID()},
+		{"second page", 2, 2, 2, want[2].id},
+		{"last page", 4, 2, 1, want[4].id},
+		{"past the end", 5, 2, 0, [32]byte{}},
+		{"negative offset", -1, 1, 1, pending.ID()},
+		{"limit too high", 0, HISTORY_MAX_PAGE_SIZE + 1, 5, pending.ID()},
+	}
+	for _, tt := range pages {
+		h := A.History(a, tt.offset, tt.limit)
+		if len(h.Entries) != tt.entries {
+			t.Errorf("%s: %d entries, want %d", tt.name, len(h.Entries), tt.entries)
+			continue
+		}
+		if h.Total != 5 {
+			t.Errorf("%s: total %d, want 5", tt.name, h.Total)
+		}
+		if tt.entries > 0 && h.Entries[0].Transaction.ID() != tt.first {
+			t.Errorf("%s: starts at %x, want %x", tt.name, h.Entries[0].Transaction.ID(), tt.first)
+		}
+	}
+
+	// a reorg takes the blocks of a off the index, only b's coinbases are
+	// left
+	B, err := NewBlockchainWithConfig(b, 0, Config{Policy: policy, MiningWorkers: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer B.Close()
+	for i := 0; i < 5; i++ {
+		B.Mining()
+	}
+	if err := A.ReplaceChain(B.Chain()); err != nil {
+		t.Fatal(err)
+	}
+	if h := A.History(a, 0, 0); h.Total != 0 {
+		t.Errorf("%d transactions after the reorg, want 0", h.Total)
+	}
+	if h := A.History(b, 0, 0); h.Total != 5 || h.Entries[0].Height != 5 {
+		t.Errorf("%d transactions after the reorg, want the 5 coinbases", h.Total)
+	}
+	if ix := addressIndexOf(A.Chain()); !reflect.DeepEqual(A.addresses, ix) {
+		t.Error("address index differs from one built from the new chain")
+	}
+}
@@ -0,0 +1,250 @@
+package block
+
+import (
+	"github.com/nazeemnato/stonkcoin/utils"
+)
+
+// balances, nonces and unspent outputs after a run of blocks. the chain keeps
+// a single ledger and applies every block to it in place, what a block
+// changed is kept in an undo so a reorg can take the block off again
+type ledger struct {
+	balances map[string]utils.Amount
+	nonces   map[string]uint64
+	// coinbases that are not mature yet, oldest first, and their total per
+	// recipient
+	coinbases []coinbaseCredit
+	immature  map[string]utils.Amount
+	utxos     *UTXOSet
+	// coinbases paid minus fees paid
+	supply utils.Amount
+	// changes of the block being applied, nil otherwise
+	undo *undo
+}
+
+type coinbaseCredit struct {
+	height  uint64
+	address string
+	amount  utils.Amount
+}
+
+func newLedger() *ledger {
+	return &ledger{
+		balances: make(map[string]utils.Amount),
+		nonces:   make(map[string]uint64),
+		immature: make(map[string]utils.Amount),
+		utxos:    NewUTXOSet(),
+	}
+}
+
+// value of an entry before a block changed it
+type savedAmount struct {
+	amount utils.Amount
+	ok     bool
+}
+
+type savedNonce struct {
+	nonce uint64
+	ok    bool
+}
+
+// output at an outpoint before a block changed it, nil if there was none
+type savedOutput struct {
+	outPoint OutPoint
+	output   *TxOutput
+}
+
+// what applying a block changed, enough to take it off the ledger again
+type undo struct {
+	balances map[string]savedAmount
+	nonces   map[string]savedNonce
+	immature map[string]savedAmount
+	// credits that matured at the block, they were the oldest ones
+	matured []coinbaseCredit
+	// credits the block added at the end
+	credited int
+	// outputs spent and created, in order
+	outputs []savedOutput
+	supply  utils.Amount
+}
+
+func newUndo() *undo {
+	return &undo{
+		balances: make(map[string]savedAmount),
+		nonces:   make(map[string]savedNonce),
+		immature: make(map[string]savedAmount),
+	}
+}
+
+func (l *ledger) setBalance(address string, amount utils.Amount) {
+	if l.undo != nil {
+		if _, ok := l.undo.balances[address]; !ok {
+			prev, ok := l.balances[address]
+			l.undo.balances[address] = savedAmount{prev, ok}
+		}
+	}
+	l.balances[address] = amount
+}
+
+func (l *ledger) setNonce(address string, nonce uint64) {
+	if l.undo != nil {
+		if _, ok := l.undo.nonces[address]; !ok {
+			prev, ok := l.nonces[address]
+			l.undo.nonces[address] = savedNonce{prev, ok}
+		}
+	}
+	l.nonces[address] = nonce
+}
+
+func (l *ledger) setImmature(address string, amount utils.Amount) {
+	if l.undo != nil {
+		if _, ok := l.undo.immature[address]; !ok {
+			prev, ok := l.immature[address]
+			l.undo.immature[address] = savedAmount{prev, ok}
+		}
+	}
+	if amount == 0 {
+		delete(l.immature, address)
+	} else {
+		l.immature[address] = amount
+	}
+}
+
+func (l *ledger) setOutput(o OutPoint, out *TxOutput) {
+	if l.undo != nil {
+		l.undo.outputs = append(l.undo.outputs, savedOutput{o, l.utxos.outputs[o]})
+	}
+	if out == nil {
+		delete(l.utxos.outputs, o)
+	} else {
+		l.utxos.outputs[o] = out
+	}
+}
+
+// lock a coinbase until it matures
+func (l *ledger) credit(address string, amount utils.Amount, height uint64) {
+	l.coinbases = append(l.coinbases, coinbaseCredit{height, address, amount})
+	l.setImmature(address, l.immature[address]+amount)
+	if l.undo != nil {
+		l.undo.credited++
+	}
+}
+
+// forget the coinbases that can be spent in the block at height. credits
+// are kept in height order, so only the oldest ones are looked at
+func (l *ledger) mature(height uint64, policy *MonetaryPolicy) {
+	n := 0
+	for n < len(l.coinbases) && policy.Mature(l.coinbases[n].height, height) {
+		c := l.coinbases[n]
+		l.setImmature(c.address, l.immature[c.address]-c.amount)
+		n++
+	}
+	if n == 0 {
+		return
+	}
+	if l.undo != nil {
+		l.undo.matured = append(l.undo.matured, l.coinbases[:n]...)
+	}
+	l.coinbases = append([]coinbaseCredit{}, l.coinbases[n:]...)
+}
+
+// part of the balance of address that can't be spent in the block at
+// height yet. height may be at most one past the last block applied
+func (l *ledger) immatureAt(address string, height uint64, policy *MonetaryPolicy) utils.Amount {
+	amount := l.immature[address]
+	for _, c := range l.coinbases {
+		if !policy.Mature(c.height, height) {
+			break
+		}
+		if c.address == address {
+			amount -= c.amount
+		}
+	}
+	return amount
+}
+
+// spend the inputs and add the outputs of t if it is a utxo transaction
+func (l *ledger) applyUTXO(t *Transaction) {
+	if !t.IsUTXO() {
+		return
+	}
+	for _, in := range t.inputs {
+		l.setOutput(in.outPoint, nil)
+	}
+	id := t.ID()
+	for i, out := range t.outputs {
+		l.setOutput(OutPoint{id, uint32(i)}, out)
+	}
+}
+
+// validate b on top of chain and apply it. the ledger is left as it was if
+// the block is invalid
+func (l *ledger) applyBlock(chain []*Block, b *Block, policy *MonetaryPolicy) (*undo, *ValidationError) {
+	u := newUndo()
+	u.supply = l.supply
+	l.undo = u
+	err := validateBlock(chain, b, l, policy)
+	l.undo = nil
+	if err != nil {
+		l.revert(u)
+		return nil, err
+	}
+	return u, nil
+}
+
+// take a block off the ledger, u has to be the undo of the last block
+// applied
+func (l *ledger) revert(u *undo) {
+	for i := len(u.outputs) - 1; i >= 0; i-- {
+		s := u.outputs[i]
+		if s.output == nil {
+			delete(l.utxos.outputs, s.outPoint)
+		} else {
+			l.utxos.outputs[s.outPoint] = s.output
+		}
+	}
+	l.supply = u.supply
+	l.coinbases = append(append([]coinbaseCredit{}, u.matured...), l.coinbases[:len(l.coinbases)-u.credited]...)
+	for address, s := range u.immature {
+		if s.ok {
+			l.immature[address] = s.amount
+		} else {
+			delete(l.immature, address)
+		}
+	}
+	for address, s := range u.nonces {
+		if s.ok {
+			l.nonces[address] = s.nonce
+		} else {
+			delete(l.nonces, address)
+		}
+	}
+	for address, s := range u.balances {
+		if s.ok {
+			l.balances[address] = s.amount
+		} else {
+			delete(l.balances, address)
+		}
+	}
+}
+
+// take the blocks from index from of undos on off the ledger, newest first
+func (l *ledger) rewind(undos []*undo, from int) {
+	for i := len(undos) - 1; i >= from; i-- {
+		l.revert(undos[i])
+	}
+}
+
+// apply chain[from:] to a ledger that is at chain[from-1] and return their
+// undos. nothing is applied if one of the blocks is invalid
+func (l *ledger) replay(chain []*Block, from int, policy *MonetaryPolicy) ([]*undo, *ValidationError) {
+	undos := make([]*undo, 0, len(chain)-from)
+	for i := from; i < len(chain); i++ {
+		u, err := l.applyBlock(chain[:i], chain[i], policy)
+		if err != nil {
+			l.rewind(undos, 0)
+			return nil, err
+		}
+		undos = append(undos, u)
+	}
+	return undos, nil
+}
@@ -0,0 +1,452 @@
+package block
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+const (
+	MEMPOOL_MAX_TRANSACTIONS = 5000
+	MEMPOOL_MAX_PER_SENDER   = 100
+	// pending transactions older than this are dropped
+	MEMPOOL_TTL = 24 * time.Hour
+	// changes to the pool within this long are written to the store at once
+	MEMPOOL_SAVE_DELAY = time.Second
+)
+
+var (
+	ErrMempoolFull = errors.New("mempool is full")
+	ErrSenderLimit = errors.New("sender has too many pending transactions")
+	ErrConflict    = errors.New("conflicts with a pending transaction of the same sender and nonce")
+)
+
+// mempool limits, zero values fall back to the MEMPOOL_ defaults
+type MempoolConfig struct {
+	MaxTransactions int
+	MaxPerSender    int
+	TTL             time.Duration
+}
+
+type mempoolEntry struct {
+	transaction *Transaction
+	id          [32]byte
+	added       time.Time
+}
+
+// pending transaction together with when it entered the pool, which is what
+// the store keeps so the TTL survives a restart
+type PendingTransaction struct {
+	Transaction *Transaction
+	Added       time.Time
+}
+
+func (p *PendingTransaction) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Transaction *Transaction `json:"transaction"`
+		Added       time.Time    `json:"added"`
+	}{p.Transaction, p.Added})
+}
+
+// also reads the bare transactions older stores wrote, they count as added
+// now
+func (p *PendingTransaction) UnmarshalJSON(data []byte) error {
+	var v struct {
+		Transaction *Transaction `json:"transaction"`
+		Added       time.Time    `json:"added"`
+	}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	if v.Transaction != nil {
+		p.Transaction, p.Added = v.Transaction, v.Added
+		return nil
+	}
+	var t Transaction
+	if err := json.Unmarshal(data, &t); err != nil {
+		return fmt.Errorf("pending transaction: %w", err)
+	}
+	p.Transaction, p.Added = &t, time.Now()
+	return nil
+}
+
+// transactions waiting to be mined, in arrival order. a sender's
+// transactions are always kept in nonce order without gaps, whatever is
+// removed takes the sender's later transactions with it. utxo transactions
+// without a deposit have no sender and are queued on their own
+type Mempool struct {
+	config   MempoolConfig
+	entries  []*mempoolEntry
+	byID     map[[32]byte]*mempoolEntry
+	bySender map[string][]*mempoolEntry
+	// pending transaction spending each output
+	spends map[OutPoint]*mempoolEntry
+	mux    sync.RWMutex
+}
+
+// create empty mempool
+func NewMempool(config MempoolConfig) *Mempool {
+	if config.MaxTransactions <= 0 {
+		config.MaxTransactions = MEMPOOL_MAX_TRANSACTIONS
+	}
+	if config.MaxPerSender <= 0 {
+		config.MaxPerSender = MEMPOOL_MAX_PER_SENDER
+	}
+	if config.TTL <= 0 {
+		config.TTL = MEMPOOL_TTL
+	}
+	return &Mempool{
+		config:   config,
+		byID:     make(map[[32]byte]*mempoolEntry),
+		bySender: make(map[string][]*mempoolEntry),
+		spends:   make(map[OutPoint]*mempoolEntry),
+	}
+}
+
+func (mp *Mempool) Config() MempoolConfig {
+	return mp.config
+}
+
+// add a transaction that follows the sender's pending ones. when the pool is
+// full the transaction with the lowest fee rate that no other one depends on
+// is evicted, as long as it pays less than t. evicted transactions are
+// returned
+func (mp *Mempool) Add(t *Transaction) ([]*Transaction, error) {
+	mp.mux.Lock()
+	defer mp.mux.Unlock()
+	id := t.ID()
+	if _, ok := mp.byID[id]; ok {
+		return nil, ErrDuplicate
+	}
+	if mp.conflict(t) != nil {
+		return nil, ErrConflict
+	}
+	for _, in := range t.inputs {
+		if _, ok := mp.spends[in.outPoint]; ok {
+			return nil, ErrOutputPending
+		}
+	}
+	if len(mp.bySender[t.queueKey()]) >= mp.config.MaxPerSender {
+		return nil, ErrSenderLimit
+	}
+	var evicted []*Transaction
+	if len(mp.entries) >= mp.config.MaxTransactions {
+		victim := mp.lowestPriority(t.queueKey())
+		if victim == nil || victim.transaction.FeeRate() >= t.FeeRate() {
+			return nil, ErrMempoolFull
+		}
+		evicted = mp.remove(victim.id)
+	}
+	mp.insert(&mempoolEntry{t, id, time.Now()}, false)
+	return evicted, nil
+}
+
+// the pending transaction of the same sender with the same nonce
+func (mp *Mempool) conflict(t *Transaction) *mempoolEntry {
+	if t.senderAddress == "" {
+		return nil
+	}
+	for _, e := range mp.bySender[t.senderAddress] {
+		if e.transaction.nonce == t.nonce {
+			return e
+		}
+	}
+	return nil
+}
+
+// pending transaction with the same sender and nonce as t, nil if there is
+// none
+func (mp *Mempool) Conflict(t *Transaction) *Transaction {
+	mp.mux.RLock()
+	defer mp.mux.RUnlock()
+	if e := mp.conflict(t); e != nil {
+		return e.transaction
+	}
+	return nil
+}
+
+// last transaction of every sender but except is a candidate, the cheapest
+// per byte loses
+func (mp *Mempool) lowestPriority(except string) *mempoolEntry {
+	var victim *mempoolEntry
+	for sender, entries := range mp.bySender {
+		if sender == except || len(entries) == 0 {
+			continue
+		}
+		last := entries[len(entries)-1]
+		if victim == nil || last.transaction.FeeRate() < victim.transaction.FeeRate() {
+			victim = last
+		}
+	}
+	return victim
+}
+
+func (mp *Mempool) insert(e *mempoolEntry, front bool) {
+	if front {
+		mp.entries = append([]*mempoolEntry{e}, mp.entries...)
+	} else {
+		mp.entries = append(mp.entries, e)
+	}
+	mp.byID[e.id] = e
+	for _, in := range e.transaction.inputs {
+		mp.spends[in.outPoint] = e
+	}
+	sender := e.transaction.queueKey()
+	entries := append(mp.bySender[sender], e)
+	// keep nonce order, orphans put back in front may be older than what
+	// is pending
+	for i := len(entries) - 1; i > 0 && entries[i].transaction.nonce < entries[i-1].transaction.nonce; i-- {
+		entries[i], entries[i-1] = entries[i-1], entries[i]
+	}
+	mp.bySender[sender] = entries
+}
+
+// remove the transaction and the sender's transactions after it
+func (mp *Mempool) remove(id [32]byte) []*Transaction {
+	e, ok := mp.byID[id]
+	if !ok {
+		return nil
+	}
+	entries := mp.bySender[e.transaction.queueKey()]
+	i := 0
+	for i < len(entries) && entries[i] != e {
+		i++
+	}
+	removed := make([]*Transaction, 0, len(entries)-i)
+	for _, d := range append([]*mempoolEntry{}, entries[i:]...) {
+		mp.drop(d)
+		removed = append(removed, d.transaction)
+	}
+	return removed
+}
+
+// take a single entry out of every index
+func (mp *Mempool) drop(e *mempoolEntry) {
+	delete(mp.byID, e.id)
+	for _, in := range e.transaction.inputs {
+		if mp.spends[in.outPoint] == e {
+			delete(mp.spends, in.outPoint)
+		}
+	}
+	sender := e.transaction.queueKey()
+	entries := make([]*mempoolEntry, 0, len(mp.bySender[sender]))
+	for _, k := range mp.bySender[sender] {
+		if k != e {
+			entries = append(entries, k)
+		}
+	}
+	if len(entries) == 0 {
+		delete(mp.bySender, sender)
+	} else {
+		mp.bySender[sender] = entries
+	}
+	for i, k := range mp.entries {
+		if k == e {
+			mp.entries = append(mp.entries[:i], mp.entries[i+1:]...)
+			break
+		}
+	}
+}
+
+// remove transactions that made it into a block. they are the first ones of
+// their senders, so nothing depends on them anymore
+func (mp *Mempool) RemoveMined(transactions []*Transaction) {
+	mp.mux.Lock()
+	defer mp.mux.Unlock()
+	for _, t := range transactions {
+		if e, ok := mp.byID[t.ID()]; ok {
+			mp.drop(e)
+		}
+	}
+}
+
+// remove a pending transaction by id together with the sender's
+// transactions that depend on it, nothing is returned if it isn't pending
+func (mp *Mempool) Remove(id [32]byte) []*Transaction {
+	mp.mux.Lock()
+	defer mp.mux.Unlock()
+	return mp.remove(id)
+}
+
+// drop transactions that have been waiting longer than the TTL
+func (mp *Mempool) Expire() []*Transaction {
+	mp.mux.Lock()
+	defer mp.mux.Unlock()
+	deadline := time.Now().Add(-mp.config.TTL)
+	cut := make(map[string]int)
+	for sender, entries := range mp.bySender {
+		for i, e := range entries {
+			if e.added.Before(deadline) {
+				cut[sender] = i
+				break
+			}
+		}
+	}
+	return mp.cutQueues(cut)
+}
+
+// keep only the transactions keep returns true for, visiting them in arrival
+// order. returns what was dropped
+func (mp *Mempool) Retain(keep func(t *Transaction) bool) []*Transaction {
+	mp.mux.Lock()
+	defer mp.mux.Unlock()
+	position := make(map[*mempoolEntry]int, len(mp.entries))
+	for _, entries := range mp.bySender {
+		for i, e := range entries {
+			position[e] = i
+		}
+	}
+	cut := make(map[string]int)
+	for _, e := range mp.entries {
+		sender := e.transaction.queueKey()
+		c, ok := cut[sender]
+		if ok && position[e] >= c {
+			// goes with an earlier transaction of its sender
+			continue
+		}
+		if !keep(e.transaction) {
+			cut[sender] = position[e]
+		}
+	}
+	return mp.cutQueues(cut)
+}
+
+// remove every sender's queue from cut[sender] on, touching each index once
+// instead of once per transaction. returns what was removed in arrival order
+func (mp *Mempool) cutQueues(cut map[string]int) []*Transaction {
+	if len(cut) == 0 {
+		return make([]*Transaction, 0)
+	}
+	dropped := make(map[*mempoolEntry]bool)
+	for sender, i := range cut {
+		entries := mp.bySender[sender]
+		for _, e := range entries[i:] {
+			dropped[e] = true
+			delete(mp.byID, e.id)
+			for _, in := range e.transaction.inputs {
+				if mp.spends[in.outPoint] == e {
+					delete(mp.spends, in.outPoint)
+				}
+			}
+		}
+		if i == 0 {
+			delete(mp.bySender, sender)
+		} else {
+			mp.bySender[sender] = entries[:i:i]
+		}
+	}
+	removed := make([]*Transaction, 0, len(dropped))
+	entries := make([]*mempoolEntry, 0, len(mp.entries)-len(dropped))
+	for _, e := range mp.entries {
+		if dropped[e] {
+			removed = append(removed, e.transaction)
+		} else {
+			entries = append(entries, e)
+		}
+	}
+	mp.entries = entries
+	return removed
+}
+
+// put transactions back in front of the pool without checking limits, used
+// for the stored pool and for transactions of blocks that left the chain.
+// they keep the time they were first added
+func (mp *Mempool) Restore(pending []*PendingTransaction) {
+	mp.mux.Lock()
+	defer mp.mux.Unlock()
+	for i := len(pending) - 1; i >= 0; i-- {
+		p := pending[i]
+		id := p.Transaction.ID()
+		if _, ok := mp.byID[id]; ok {
+			continue
+		}
+		mp.insert(&mempoolEntry{p.Transaction, id, p.Added}, true)
+	}
+}
+
+// pending transactions in arrival order with the time they were added
+func (mp *Mempool) Pending() []*PendingTransaction {
+	mp.mux.RLock()
+	defer mp.mux.RUnlock()
+	pending := make([]*PendingTransaction, len(mp.entries))
+	for i, e := range mp.entries {
+		pending[i] = &PendingTransaction{e.transaction, e.added}
+	}
+	return pending
+}
+
+// pending transaction by id
+func (mp *Mempool) Get(id [32]byte) (*Transaction, bool) {
+	mp.mux.RLock()
+	defer mp.mux.RUnlock()
+	e, ok := mp.byID[id]
+	if !ok {
+		return nil, false
+	}
+	return e.transaction, true
+}
+
+// pending transaction spending the output, nil if there is none
+func (mp *Mempool) Spender(o OutPoint) *Transaction {
+	mp.mux.RLock()
+	defer mp.mux.RUnlock()
+	if e, ok := mp.spends[o]; ok {
+		return e.transaction
+	}
+	return nil
+}
+
+// pending transactions in arrival order
+func (mp *Mempool) Transactions() []*Transaction {
+	mp.mux.RLock()
+	defer mp.mux.RUnlock()
+	transactions := make([]*Transaction, len(mp.entries))
+	for i, e := range mp.entries {
+		transactions[i] = e.transaction
+	}
+	return transactions
+}
+
+// pending transactions of sender in nonce order
+func (mp *Mempool) BySender(sender string) []*Transaction {
+	mp.mux.RLock()
+	defer mp.mux.RUnlock()
+	entries := mp.bySender[sender]
+	transactions := make([]*Transaction, len(entries))
+	for i, e := range entries {
+		transactions[i] = e.transaction
+	}
+	return transactions
+}
+
+func (mp *Mempool) Len() int {
+	mp.mux.RLock()
+	defer mp.mux.RUnlock()
+	return len(mp.entries)
+}
+
+func (mp *Mempool) MarshalJSON() ([]byte, error) {
+	mp.mux.RLock()
+	defer mp.mux.RUnlock()
+	size := 0
+	for _, e := range mp.entries {
+		size += e.transaction.Size()
+	}
+	return json.Marshal(struct {
+		Transactions    int    `json:"transactions"`
+		Senders         int    `json:"senders"`
+		Size            int    `json:"size"`
+		MaxTransactions int    `json:"maxTransactions"`
+		MaxPerSender    int    `json:"maxPerSender"`
+		TTL             string `json:"ttl"`
+	}{
+		Transactions:    len(mp.entries),
+		Senders:         len(mp.bySender),
+		Size:            size,
+		MaxTransactions: mp.config.MaxTransactions,
+		MaxPerSender:    mp.config.MaxPerSender,
+		TTL:             mp.config.TTL.String(),
+	})
+}
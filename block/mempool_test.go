@@ -0,0 +1,177 @@
+package block
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/nazeemnato/stonkcoin/utils"
+)
+
+func testTransfer(sender string, nonce uint64, fee utils.Amount) *Transaction {
+	return NewTransaction(sender, "recipient", utils.COIN, fee, nonce)
+}
+
+func pendingIDs(mp *Mempool) map[[32]byte]bool {
+	ids := make(map[[32]byte]bool)
+	for _, t := range mp.Transactions() {
+		ids[t.ID()] = true
+	}
+	return ids
+}
+
+func TestMempoolAdd(t *testing.T) {
+	mp := NewMempool(MempoolConfig{MaxPerSender: 2})
+	a0 := testTransfer("a", 0, 1)
+	if _, err := mp.Add(a0); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name string
+		t    *Transaction
+		err  error
+	}{
+		{"duplicate", a0, ErrDuplicate},
+		{"same nonce", testTransfer("a", 0, 2), ErrConflict},
+		{"next nonce", testTransfer("a", 1, 1), nil},
+		{"sender limit", testTransfer("a", 2, 1), ErrSenderLimit},
+		{"other sender", testTransfer("b", 0, 1), nil},
+	}
+	for _, tt := range tests {
+		if _, err := mp.Add(tt.t); !errors.Is(err, tt.err) {
+			t.Errorf("%s: error %v, want %v", tt.name, err, tt.err)
+		}
+	}
+	if mp.Len() != 3 {
+		t.Errorf("%d pending, want 3", mp.Len())
+	}
+}
+
+func TestMempoolEviction(t *testing.T) {
+	a0 := testTransfer("a", 0, 100)
+	a1 := testTransfer("a", 1, 1)
+	b0 := testTransfer("b", 0, 50)
+	tests := []struct {
+		name    string
+		t       *Transaction
+		evicted *Transaction
+		err     error
+	}{
+		// a1 is the cheapest that nothing depends on, a0 is kept even
+		// though a1 goes
+		{"pays more", testTransfer("c", 0, 10), a1, nil},
+		{"pays less", testTransfer("c", 0, 0), nil, ErrMempoolFull},
+		// a sender never evicts its own transactions, b0 goes although
+		// a1 pays less
+		{"own queue", testTransfer("a", 2, 1000), b0, nil},
+	}
+	for _, tt := range tests {
+		mp := NewMempool(MempoolConfig{MaxTransactions: 3})
+		for _, p := range []*Transaction{a0, a1, b0} {
+			if _, err := mp.Add(p); err != nil {
+				t.Fatal(err)
+			}
+		}
+		evicted, err := mp.Add(tt.t)
+		if !errors.Is(err, tt.err) {
+			t.Errorf("%s: error %v, want %v", tt.name, err, tt.err)
+			continue
+		}
+		if tt.evicted == nil {
+			if len(evicted) != 0 {
+				t.Errorf("%s: evicted %d transactions", tt.name, len(evicted))
+			}
+			continue
+		}
+		if len(evicted) != 1 || evicted[0].ID() != tt.evicted.ID() {
+			t.Errorf("%s: evicted %v, want %s's nonce %d", tt.name, evicted, tt.evicted.senderAddress, tt.evicted.nonce)
+		}
+		if ids := pendingIDs(mp); ids[tt.evicted.ID()] || !ids[tt.t.ID()] {
+			t.Errorf("%s: pool still holds the evicted transaction or lacks the new one", tt.name)
+		}
+	}
+}
+
+func TestMempoolRemoveTakesLaterNonces(t *testing.T) {
+	mp := NewMempool(MempoolConfig{})
+	a0, a1, a2 := testTransfer("a", 0, 1), testTransfer("a", 1, 1), testTransfer("a", 2, 1)
+	for _, p := range []*Transaction{a0, a1, a2} {
+		mp.Add(p)
+	}
+	if removed := mp.Remove(a1.ID()); len(removed) != 2 {
+		t.Errorf("removed %d transactions, want a1 and a2", len(removed))
+	}
+	if ids := pendingIDs(mp); len(ids) != 1 || !ids[a0.ID()] {
+		t.Errorf("pool holds %d transactions, want only a0", len(ids))
+	}
+}
+
+func TestMempoolExpire(t *testing.T) {
+	ttl := time.Hour
+	old := time.Now().Add(-2 * ttl)
+	fresh := time.Now()
+	a0, a1 := testTransfer("a", 0, 1), testTransfer("a", 1, 1)
+	b0 := testTransfer("b", 0, 1)
+	c0, c1 := testTransfer("c", 0, 1), testTransfer("c", 1, 1)
+	mp := NewMempool(MempoolConfig{TTL: ttl})
+	mp.Restore([]*PendingTransaction{
+		// a1 is fresh but goes along with the old transaction it follows
+		{a0, old}, {a1, fresh},
+		{b0, fresh},
+		{c0, fresh}, {c1, old},
+	})
+	expired := mp.Expire()
+	if len(expired) != 3 {
+		t.Errorf("expired %d transactions, want 3", len(expired))
+	}
+	ids := pendingIDs(mp)
+	if len(ids) != 2 || !ids[b0.ID()] || !ids[c0.ID()] {
+		t.Errorf("pool holds %d transactions, want b0 and c0", len(ids))
+	}
+	for _, p := range mp.Pending() {
+		if !p.Added.Equal(fresh) {
+			t.Errorf("restored transaction was added at %s, want %s", p.Added, fresh)
+		}
+	}
+}
+
+func TestMempoolRetain(t *testing.T) {
+	mp := NewMempool(MempoolConfig{})
+	a0, a1, a2 := testTransfer("a", 0, 1), testTransfer("a", 1, 1), testTransfer("a", 2, 1)
+	b0 := testTransfer("b", 0, 1)
+	for _, p := range []*Transaction{a0, a1, b0, a2} {
+		mp.Add(p)
+	}
+	visited := make(map[[32]byte]bool)
+	dropped := mp.Retain(func(t *Transaction) bool {
+		visited[t.ID()] = true
+		return t != a1
+	})
+	if len(dropped) != 2 || dropped[0] != a1 || dropped[1] != a2 {
+		t.Errorf("dropped %v, want a1 and a2 in arrival order", dropped)
+	}
+	if visited[a2.ID()] {
+		t.Error("a2 was visited after the transaction it follows was dropped")
+	}
+	ids := pendingIDs(mp)
+	if len(ids) != 2 || !ids[a0.ID()] || !ids[b0.ID()] {
+		t.Errorf("pool holds %d transactions, want a0 and b0", len(ids))
+	}
+	// the sender's queue ends at a0 again
+	if _, err := mp.Add(testTransfer("a", 1, 2)); err != nil {
+		t.Errorf("next nonce after the cut: %s", err)
+	}
+}
+
+func TestMempoolRestoreKeepsNonceOrder(t *testing.T) {
+	mp := NewMempool(MempoolConfig{})
+	a1 := testTransfer("a", 1, 1)
+	mp.Add(a1)
+	// a0 comes back from a block that left the chain
+	a0 := testTransfer("a", 0, 1)
+	mp.Restore([]*PendingTransaction{{a0, time.Now()}})
+	sent := mp.BySender("a")
+	if len(sent) != 2 || sent[0].nonce != 0 || sent[1].nonce != 1 {
+		t.Errorf("sender queue out of order: %v", sent)
+	}
+}
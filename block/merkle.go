@@ -0,0 +1,169 @@
+package block
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+)
+
+// leaves and interior nodes are hashed under different prefixes, so an
+// interior node can't be passed off as a leaf
+const (
+	merkleLeafPrefix = 0x00
+	merkleNodePrefix = 0x01
+)
+
+// root of the binary hash tree over leaves, an odd node at any level is
+// paired with itself. no leaves give the zero hash
+//
+// pairing an odd node with itself means leaves with the last ones repeated
+// give the same root, blocks must not repeat a transaction for that reason
+func MerkleRoot(leaves [][32]byte) [32]byte {
+	if len(leaves) == 0 {
+		return [32]byte{}
+	}
+	level := merkleLeaves(leaves)
+	for len(level) > 1 {
+		level = merkleLevel(level)
+	}
+	return level[0]
+}
+
+// hash pairs of nodes into the next level up
+func merkleLevel(level [][32]byte) [][32]byte {
+	next := make([][32]byte, 0, (len(level)+1)/2)
+	for i := 0; i < len(level); i += 2 {
+		right := level[i]
+		if i+1 < len(level) {
+			right = level[i+1]
+		}
+		next = append(next, merkleParent(level[i], right))
+	}
+	return next
+}
+
+func merkleLeaves(leaves [][32]byte) [][32]byte {
+	level := make([][32]byte, len(leaves))
+	for i, leaf := range leaves {
+		level[i] = merkleLeaf(leaf)
+	}
+	return level
+}
+
+func merkleLeaf(leaf [32]byte) [32]byte {
+	buf := make([]byte, 33)
+	buf[0] = merkleLeafPrefix
+	copy(buf[1:], leaf[:])
+	return sha256.Sum256(buf)
+}
+
+func merkleParent(left [32]byte, right [32]byte) [32]byte {
+	buf := make([]byte, 65)
+	buf[0] = merkleNodePrefix
+	copy(buf[1:33], left[:])
+	copy(buf[33:], right[:])
+	return sha256.Sum256(buf)
+}
+
+// merkle root committing to every transaction of a block, signatures included
+func TransactionsMerkleRoot(transactions []*Transaction) [32]byte {
+	leaves := make([][32]byte, len(transactions))
+	for i, t := range transactions {
+		leaves[i] = t.Hash()
+	}
+	return MerkleRoot(leaves)
+}
+
+// path from a leaf up to the merkle root
+type MerkleProof struct {
+	index    int
+	leaf     [32]byte
+	siblings [][32]byte
+}
+
+// build the proof that leaves[index] is part of MerkleRoot(leaves)
+func NewMerkleProof(leaves [][32]byte, index int) (*MerkleProof, error) {
+	if index < 0 || index >= len(leaves) {
+		return nil, fmt.Errorf("leaf %d out of range", index)
+	}
+	proof := &MerkleProof{index: index, leaf: leaves[index]}
+	level := merkleLeaves(leaves)
+	for i := index; len(level) > 1; i /= 2 {
+		sibling := i ^ 1
+		if sibling >= len(level) {
+			sibling = i
+		}
+		proof.siblings = append(proof.siblings, level[sibling])
+		level = merkleLevel(level)
+	}
+	return proof, nil
+}
+
+func (mp *MerkleProof) Index() int {
+	return mp.index
+}
+
+func (mp *MerkleProof) Leaf() [32]byte {
+	return mp.leaf
+}
+
+// fold the siblings into the root the proof leads to
+func (mp *MerkleProof) Root() [32]byte {
+	hash := merkleLeaf(mp.leaf)
+	i := mp.index
+	for _, sibling := range mp.siblings {
+		if i%2 == 0 {
+			hash = merkleParent(hash, sibling)
+		} else {
+			hash = merkleParent(sibling, hash)
+		}
+		i /= 2
+	}
+	return hash
+}
+
+// check that the proof leads from leaf to root
+func (mp *MerkleProof) Verify(leaf [32]byte, root [32]byte) bool {
+	return mp.leaf == leaf && mp.Root() == root
+}
+
+func (mp *MerkleProof) MarshalJSON() ([]byte, error) {
+	siblings := make([]string, len(mp.siblings))
+	for i, s := range mp.siblings {
+		siblings[i] = fmt.Sprintf("%x", s)
+	}
+	return json.Marshal(struct {
+		Index    int      `json:"index"`
+		Leaf     string   `json:"leaf"`
+		Siblings []string `json:"siblings"`
+	}{
+		Index:    mp.index,
+		Leaf:     fmt.Sprintf("%x", mp.leaf),
+		Siblings: siblings,
+	})
+}
+
+func (mp *MerkleProof) UnmarshalJSON(data []byte) error {
+	var v struct {
+		Index    int      `json:"index"`
+		Leaf     string   `json:"leaf"`
+		Siblings []string `json:"siblings"`
+	}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	if v.Index < 0 {
+		return fmt.Errorf("invalid index %d", v.Index)
+	}
+	if err := decodeHash(v.Leaf, &mp.leaf); err != nil {
+		return fmt.Errorf("invalid leaf %q", v.Leaf)
+	}
+	mp.index = v.Index
+	mp.siblings = make([][32]byte, len(v.Siblings))
+	for i, s := range v.Siblings {
+		if err := decodeHash(s, &mp.siblings[i]); err != nil {
+			return fmt.Errorf("invalid sibling %q", s)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,98 @@
+package block
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"testing"
+)
+
+func testLeaves(n int) [][32]byte {
+	leaves := make([][32]byte, n)
+	for i := range leaves {
+		leaves[i] = sha256.Sum256([]byte{byte(i)})
+	}
+	return leaves
+}
+
+func TestMerkleRoot(t *testing.T) {
+	leaves := testLeaves(3)
+	tests := []struct {
+		name   string
+		leaves [][32]byte
+		want   [32]byte
+	}{
+		{"empty", nil, [32]byte{}},
+		{"single", leaves[:1], merkleLeaf(leaves[0])},
+		{"pair", leaves[:2], merkleParent(merkleLeaf(leaves[0]), merkleLeaf(leaves[1]))},
+		// the odd leaf is paired with itself
+		{"odd", leaves, merkleParent(
+			merkleParent(merkleLeaf(leaves[0]), merkleLeaf(leaves[1])),
+			merkleParent(merkleLeaf(leaves[2]), merkleLeaf(leaves[2])),
+		)},
+	}
+	for _, tt := range tests {
+		if got := MerkleRoot(tt.leaves); got != tt.want {
+			t.Errorf("%s: root %x, want %x", tt.name, got, tt.want)
+		}
+	}
+	// an interior node passed off as a leaf doesn't give the same root
+	root := MerkleRoot(leaves[:2])
+	node := merkleParent(merkleLeaf(leaves[0]), merkleLeaf(leaves[1]))
+	if MerkleRoot([][32]byte{node}) == root {
+		t.Error("interior node hashes like a leaf")
+	}
+}
+
+func TestMerkleProof(t *testing.T) {
+	for n := 1; n <= 9; n++ {
+		leaves := testLeaves(n)
+		root := MerkleRoot(leaves)
+		for i := 0; i < n; i++ {
+			proof, err := NewMerkleProof(leaves, i)
+			if err != nil {
+				t.Fatalf("%d leaves, index %d: %s", n, i, err)
+			}
+			if !proof.Verify(leaves[i], root) {
+				t.Errorf("%d leaves, index %d: proof does not verify", n, i)
+			}
+			other := leaves[(i+1)%n]
+			if n > 1 && proof.Verify(other, root) {
+				t.Errorf("%d leaves, index %d: proof verifies another leaf", n, i)
+			}
+			if proof.Verify(leaves[i], sha256.Sum256(root[:])) {
+				t.Errorf("%d leaves, index %d: proof verifies another root", n, i)
+			}
+		}
+	}
+}
+
+func TestMerkleProofOutOfRange(t *testing.T) {
+	leaves := testLeaves(4)
+	for _, i := range []int{-1, 4} {
+		if _, err := NewMerkleProof(leaves, i); err == nil {
+			t.Errorf("index %d was accepted", i)
+		}
+	}
+}
+
+func TestMerkleProofJSON(t *testing.T) {
+	leaves := testLeaves(5)
+	proof, err := NewMerkleProof(leaves, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := json.Marshal(proof)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var back MerkleProof
+	if err := json.Unmarshal(m, &back); err != nil {
+		t.Fatal(err)
+	}
+	if back.Index() != 4 || !back.Verify(leaves[4], MerkleRoot(leaves)) {
+		t.Errorf("proof did not survive a json round trip: %s", m)
+	}
+	if err := json.Unmarshal([]byte(`{"index":-1,"leaf":"","siblings":[]}`), &back); err == nil {
+		t.Error("negative index was accepted")
+	}
+}
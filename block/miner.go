@@ -0,0 +1,186 @@
+package block
+
+import (
+	"context"
+	"errors"
+	"log"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/nazeemnato/stonkcoin/utils"
+)
+
+// nonces a worker tries between looking at its context
+const MINER_CHECK_EVERY = 4096
+
+// searches for proof of work with several goroutines, the chain is only
+// locked while the block template is built and when the block is added
+type Miner struct {
+	workers int
+	// nonces tried since the miner was created
+	hashes uint64
+	// nanoseconds spent in finished searches and start of the running one
+	busy    int64
+	started int64
+}
+
+// create miner with workers goroutines, one per cpu when workers <= 0
+func NewMiner(workers int) *Miner {
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+	return &Miner{workers: workers}
+}
+
+func (m *Miner) Workers() int {
+	return m.workers
+}
+
+// number of nonces tried so far
+func (m *Miner) Hashes() uint64 {
+	return atomic.LoadUint64(&m.hashes)
+}
+
+// nonces tried per second of searching
+func (m *Miner) HashRate() float64 {
+	busy := atomic.LoadInt64(&m.busy)
+	if started := atomic.LoadInt64(&m.started); started != 0 {
+		busy += time.Now().UnixNano() - started
+	}
+	if busy <= 0 {
+		return 0
+	}
+	return float64(m.Hashes()) / time.Duration(busy).Seconds()
+}
+
+// search the nonce space of header until a nonce meets its difficulty or ctx
+// is done. worker i tries nonces i, i+workers, i+2*workers...
+func (m *Miner) Solve(ctx context.Context, header BlockHeader) (uint64, bool) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	start := time.Now().UnixNano()
+	atomic.StoreInt64(&m.started, start)
+	defer func() {
+		atomic.StoreInt64(&m.started, 0)
+		atomic.AddInt64(&m.busy, time.Now().UnixNano()-start)
+	}()
+	found := make(chan uint64, m.workers)
+	var wg sync.WaitGroup
+	for i := 0; i < m.workers; i++ {
+		wg.Add(1)
+		go func(h BlockHeader, start uint64) {
+			defer wg.Done()
+			step := uint64(m.workers)
+			tried := uint64(0)
+			for h.nonce = start; ; h.nonce += step {
+				if h.ValidProof() {
+					atomic.AddUint64(&m.hashes, tried+1)
+					found <- h.nonce
+					cancel()
+					return
+				}
+				tried++
+				if tried == MINER_CHECK_EVERY {
+					atomic.AddUint64(&m.hashes, tried)
+					tried = 0
+					if ctx.Err() != nil {
+						return
+					}
+				}
+			}
+		}(header, uint64(i))
+	}
+	wg.Wait()
+	select {
+	case nonce := <-found:
+		return nonce, true
+	default:
+		return 0, false
+	}
+}
+
+// mine the next block paying rewardAddress and add it to bc. the search is
+// restarted from a fresh template whenever the tip or the pool changes and
+// given up once ctx is done
+func (m *Miner) Mine(ctx context.Context, bc *Blockchain, rewardAddress string) (*Block, error) {
+	for {
+		b, changes := bc.blockTemplate(rewardAddress)
+		search, cancel := context.WithCancel(ctx)
+		go func() {
+			select {
+			case <-changes:
+				cancel()
+			case <-search.Done():
+			}
+		}()
+		nonce, ok := m.Solve(search, b.header)
+		cancel()
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		if !ok {
+			log.Printf("Chain changed while mining block %d, restarting\n", b.Height())
+			continue
+		}
+		b.header.nonce = nonce
+		if err := bc.AddBlock(b); err != nil {
+			// a peer's block got there first
+			if errors.Is(err, ErrBlockNotOnTip) {
+				continue
+			}
+			return nil, err
+		}
+		return b, nil
+	}
+}
+
+// channel that is closed the next time a block is added, the chain is
+// replaced or the pool changes
+func (bc *Blockchain) Changes() <-chan struct{} {
+	bc.mux.RLock()
+	defer bc.mux.RUnlock()
+	return bc.changed
+}
+
+// wake up everyone waiting on Changes, called with the lock held
+func (bc *Blockchain) notifyChange() {
+	close(bc.changed)
+	bc.changed = make(chan struct{})
+}
+
+// snapshot of the next block: the tip, the pending transactions paying the
+// best fee rates and a coinbase paying rewardAddress the reward plus their
+// fees. the nonce is left for the miner
+func (bc *Blockchain) BlockTemplate(rewardAddress string) *Block {
+	b, _ := bc.blockTemplate(rewardAddress)
+	return b
+}
+
+// template together with the channel that tells when it went stale
+func (bc *Blockchain) blockTemplate(rewardAddress string) (*Block, <-chan struct{}) {
+	bc.mux.Lock()
+	defer bc.mux.Unlock()
+	bc.pruneTransactionPool()
+	height := uint64(len(bc.chain))
+	// room for the coinbase, its amount can't be longer than MAX_AMOUNT
+	reserved := NewCoinbaseTransaction(rewardAddress, utils.MAX_AMOUNT, height).Size()
+	transactions := selectTransactions(bc.mempool.Transactions(), MAX_BLOCK_TRANSACTIONS-1, MAX_BLOCK_SIZE-reserved)
+	// fees can't overflow, every sender had them covered by its balance
+	fees, _ := totalFees(transactions)
+	reward, err := bc.policy.Subsidy(height).Add(fees)
+	if err != nil {
+		reward = utils.MAX_AMOUNT
+	}
+	// once the supply is used up a block without fees pays nothing
+	if reward > 0 {
+		transactions = append(transactions, NewCoinbaseTransaction(rewardAddress, reward, height))
+	}
+	return NewBlock(height, bc.lastBlock().Hash(), transactions, NextDifficulty(bc.chain)), bc.changed
+}
+
+// the miner the blockchain mines with
+func (bc *Blockchain) Miner() *Miner {
+	return bc.miner
+}
@@ -0,0 +1,64 @@
+package block
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func testHeader(difficulty uint32) BlockHeader {
+	coinbase := NewCoinbaseTransaction("miner", MINING_REWARD, 1)
+	return NewBlock(1, GenesisBlock().Hash(), []*Transaction{coinbase}, difficulty).header
+}
+
+func TestSolve(t *testing.T) {
+	for _, workers := range []int{1, 2, 4} {
+		m := NewMiner(workers)
+		header := testHeader(MIN_DIFFICULTY)
+		nonce, ok := m.Solve(context.Background(), header)
+		if !ok {
+			t.Errorf("%d workers: no nonce found", workers)
+			continue
+		}
+		header.nonce = nonce
+		if !header.ValidProof() {
+			t.Errorf("%d workers: nonce %d doesn't meet difficulty %d", workers, nonce, MIN_DIFFICULTY)
+		}
+		if m.Hashes() == 0 {
+			t.Errorf("%d workers: no hashes counted", workers)
+		}
+	}
+}
+
+// a difficulty nobody meets is only given up on through the context
+func TestSolveCancel(t *testing.T) {
+	tests := []struct {
+		name  string
+		after time.Duration
+	}{
+		{"cancelled before", 0},
+		{"cancelled while searching", 50 * time.Millisecond},
+	}
+	for _, tt := range tests {
+		ctx, cancel := context.WithCancel(context.Background())
+		if tt.after == 0 {
+			cancel()
+		} else {
+			time.AfterFunc(tt.after, cancel)
+		}
+		done := make(chan bool)
+		go func() {
+			_, ok := NewMiner(4).Solve(ctx, testHeader(MAX_DIFFICULTY))
+			done <- ok
+		}()
+		select {
+		case ok := <-done:
+			if ok {
+				t.Errorf("%s: found a nonce at difficulty %d", tt.name, MAX_DIFFICULTY)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("%s: Solve kept searching after its context was cancelled", tt.name)
+		}
+		cancel()
+	}
+}
@@ -0,0 +1,168 @@
+package block
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/nazeemnato/stonkcoin/utils"
+)
+
+const (
+	// blocks between two halvings of the subsidy
+	HALVING_INTERVAL = 100000
+	// no more than this is ever created by coinbases
+	MAX_SUPPLY = 2000000 * utils.COIN
+	// blocks a coinbase needs on top of it, itself included, before it can
+	// be spent
+	COINBASE_MATURITY = 10
+)
+
+// how much new money every block may create. all nodes of a network have to
+// agree on it, blocks paying more are rejected
+type MonetaryPolicy struct {
+	// subsidy of the first block, halved every HalvingInterval blocks
+	InitialSubsidy  utils.Amount
+	HalvingInterval uint64
+	MaxSupply       utils.Amount
+	// confirmations before a coinbase can be spent, 0 or 1 spends right
+	// away in the next block
+	CoinbaseMaturity uint64
+}
+
+// the policy of the main network
+func DefaultMonetaryPolicy() *MonetaryPolicy {
+	return &MonetaryPolicy{
+		InitialSubsidy:   MINING_REWARD,
+		HalvingInterval:  HALVING_INTERVAL,
+		MaxSupply:        MAX_SUPPLY,
+		CoinbaseMaturity: COINBASE_MATURITY,
+	}
+}
+
+func (p *MonetaryPolicy) Validate() error {
+	if p.InitialSubsidy <= 0 {
+		return fmt.Errorf("initial subsidy must be positive")
+	}
+	if p.HalvingInterval == 0 {
+		return fmt.Errorf("halving interval must be positive")
+	}
+	if p.MaxSupply < p.InitialSubsidy {
+		return fmt.Errorf("max supply %s is below the initial subsidy %s", p.MaxSupply, p.InitialSubsidy)
+	}
+	return nil
+}
+
+// subsidy before the supply cap, halved once per era
+func (p *MonetaryPolicy) scheduled(height uint64) utils.Amount {
+	if height == 0 {
+		return 0
+	}
+	if p.HalvingInterval == 0 {
+		return p.InitialSubsidy
+	}
+	era := (height - 1) / p.HalvingInterval
+	if era >= 63 {
+		return 0
+	}
+	return p.InitialSubsidy >> era
+}
+
+// new money the coinbase of the block at height may claim on top of fees.
+// the genesis block has no coinbase
+func (p *MonetaryPolicy) Subsidy(height uint64) utils.Amount {
+	if height == 0 {
+		return 0
+	}
+	subsidy := p.scheduled(height)
+	if remaining := p.MaxSupply - p.Issued(height-1); subsidy > remaining {
+		return remaining
+	}
+	return subsidy
+}
+
+// total subsidy of the blocks up to and including height
+func (p *MonetaryPolicy) Issued(height uint64) utils.Amount {
+	var total utils.Amount
+	start := uint64(1)
+	for start <= height {
+		subsidy := p.scheduled(start)
+		if subsidy == 0 {
+			break
+		}
+		end := height
+		if p.HalvingInterval != 0 {
+			if eraEnd := ((start-1)/p.HalvingInterval + 1) * p.HalvingInterval; eraEnd < end {
+				end = eraEnd
+			}
+		}
+		blocks := end - start + 1
+		if blocks > uint64(p.MaxSupply/subsidy) {
+			return p.MaxSupply
+		}
+		if total += utils.Amount(blocks) * subsidy; total >= p.MaxSupply {
+			return p.MaxSupply
+		}
+		start = end + 1
+	}
+	return total
+}
+
+// whether a coinbase mined at height can be spent in the block at spendAt
+func (p *MonetaryPolicy) Mature(height uint64, spendAt uint64) bool {
+	return spendAt >= height+p.CoinbaseMaturity
+}
+
+// first height with a lower subsidy than the block at height, 0 if the
+// subsidy never halves
+func (p *MonetaryPolicy) NextHalving(height uint64) uint64 {
+	if p.HalvingInterval == 0 || p.Subsidy(height) == 0 {
+		return 0
+	}
+	if height == 0 {
+		return p.HalvingInterval + 1
+	}
+	return ((height-1)/p.HalvingInterval+1)*p.HalvingInterval + 1
+}
+
+// money in existence at the tip of a chain
+type Supply struct {
+	Height uint64
+	// coinbases paid minus fees paid, fees a miner didn't claim are gone
+	Circulating utils.Amount
+	// subsidy the policy allowed so far
+	Issued      utils.Amount
+	MaxSupply   utils.Amount
+	Subsidy     utils.Amount
+	NextHalving uint64
+}
+
+func (bc *Blockchain) Supply() *Supply {
+	bc.mux.RLock()
+	defer bc.mux.RUnlock()
+	height := uint64(len(bc.chain) - 1)
+	// the ledger keeps the running total as blocks are applied
+	return &Supply{
+		Height:      height,
+		Circulating: bc.state.supply,
+		Issued:      bc.policy.Issued(height),
+		MaxSupply:   bc.policy.MaxSupply,
+		Subsidy:     bc.policy.Subsidy(height + 1),
+		NextHalving: bc.policy.NextHalving(height + 1),
+	}
+}
+
+// policy the blockchain validates coinbases with
+func (bc *Blockchain) MonetaryPolicy() *MonetaryPolicy {
+	return bc.policy
+}
+
+func (s *Supply) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Height      uint64       `json:"height"`
+		Circulating utils.Amount `json:"circulating"`
+		Issued      utils.Amount `json:"issued"`
+		MaxSupply   utils.Amount `json:"maxSupply"`
+		Subsidy     utils.Amount `json:"subsidy"`
+		NextHalving uint64       `json:"nextHalving,omitempty"`
+	}{s.Height, s.Circulating, s.Issued, s.MaxSupply, s.Subsidy, s.NextHalving})
+}
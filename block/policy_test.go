@@ -0,0 +1,129 @@
+package block
+
+import (
+	"testing"
+
+	"github.com/nazeemnato/stonkcoin/utils"
+)
+
+// 100 per block, halved every 10 blocks, capped during the second era
+func testPolicy() *MonetaryPolicy {
+	return &MonetaryPolicy{
+		InitialSubsidy:   100,
+		HalvingInterval:  10,
+		MaxSupply:        1120,
+		CoinbaseMaturity: 3,
+	}
+}
+
+func TestSubsidy(t *testing.T) {
+	p := testPolicy()
+	p.MaxSupply = MAX_SUPPLY
+	tests := []struct {
+		height uint64
+		want   utils.Amount
+	}{
+		{0, 0},
+		{1, 100},
+		{10, 100},
+		{11, 50},
+		{20, 50},
+		{21, 25},
+		{30, 25},
+		{31, 12},
+		// shifted out after 63 eras
+		{10*63 + 1, 0},
+	}
+	for _, tt := range tests {
+		if got := p.Subsidy(tt.height); got != tt.want {
+			t.Errorf("Subsidy(%d) = %d, want %d", tt.height, got, tt.want)
+		}
+	}
+}
+
+func TestIssuedCap(t *testing.T) {
+	p := testPolicy()
+	tests := []struct {
+		height  uint64
+		issued  utils.Amount
+		subsidy utils.Amount
+	}{
+		{0, 0, 0},
+		{10, 1000, 100},
+		{12, 1100, 50},
+		// only 20 are left under the cap
+		{13, 1120, 20},
+		{14, 1120, 0},
+		{1000, 1120, 0},
+	}
+	for _, tt := range tests {
+		if got := p.Issued(tt.height); got != tt.issued {
+			t.Errorf("Issued(%d) = %d, want %d", tt.height, got, tt.issued)
+		}
+		if got := p.Subsidy(tt.height); got != tt.subsidy {
+			t.Errorf("Subsidy(%d) = %d, want %d", tt.height, got, tt.subsidy)
+		}
+	}
+}
+
+func TestNextHalving(t *testing.T) {
+	p := testPolicy()
+	tests := []struct {
+		height uint64
+		want   uint64
+	}{
+		// genesis pays no subsidy
+		{0, 0},
+		{1, 11},
+		{10, 11},
+		{11, 21},
+		// the cap ends the subsidy before the next halving
+		{14, 0},
+	}
+	for _, tt := range tests {
+		if got := p.NextHalving(tt.height); got != tt.want {
+			t.Errorf("NextHalving(%d) = %d, want %d", tt.height, got, tt.want)
+		}
+	}
+}
+
+func TestMature(t *testing.T) {
+	p := testPolicy()
+	tests := []struct {
+		height  uint64
+		spendAt uint64
+		want    bool
+	}{
+		{5, 6, false},
+		{5, 7, false},
+		{5, 8, true},
+		{5, 9, true},
+	}
+	for _, tt := range tests {
+		if got := p.Mature(tt.height, tt.spendAt); got != tt.want {
+			t.Errorf("Mature(%d, %d) = %v, want %v", tt.height, tt.spendAt, got, tt.want)
+		}
+	}
+}
+
+func TestPolicyValidate(t *testing.T) {
+	tests := []struct {
+		name  string
+		edit  func(p *MonetaryPolicy)
+		valid bool
+	}{
+		{"default", func(p *MonetaryPolicy) { *p = *DefaultMonetaryPolicy() }, true},
+		{"test policy", func(p *MonetaryPolicy) {}, true},
+		{"cap equals subsidy", func(p *MonetaryPolicy) { p.MaxSupply = p.InitialSubsidy }, true},
+		{"zero subsidy", func(p *MonetaryPolicy) { p.InitialSubsidy = 0 }, false},
+		{"zero interval", func(p *MonetaryPolicy) { p.HalvingInterval = 0 }, false},
+		{"cap below subsidy", func(p *MonetaryPolicy) { p.MaxSupply = p.InitialSubsidy - 1 }, false},
+	}
+	for _, tt := range tests {
+		p := testPolicy()
+		tt.edit(p)
+		if err := p.Validate(); (err == nil) != tt.valid {
+			t.Errorf("%s: Validate() = %v, want valid %v", tt.name, err, tt.valid)
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package block
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+var ErrTransactionNotFound = errors.New("transaction not found in the chain")
+
+// everything a light client needs to check that a transaction was mined
+// without downloading its block
+type TransactionProof struct {
+	transaction *Transaction
+	blockHash   [32]byte
+	height      uint64
+	proof       *MerkleProof
+}
+
+func (tp *TransactionProof) Transaction() *Transaction {
+	return tp.transaction
+}
+
+func (tp *TransactionProof) BlockHash() [32]byte {
+	return tp.blockHash
+}
+
+func (tp *TransactionProof) Height() uint64 {
+	return tp.height
+}
+
+// check the proof against the header of the block it claims to be in
+func (tp *TransactionProof) Verify(header *BlockHeader) error {
+	if header.Hash() != tp.blockHash {
+		return fmt.Errorf("header %x is not block %x", header.Hash(), tp.blockHash)
+	}
+	if !tp.proof.Verify(tp.transaction.Hash(), header.merkleRoot) {
+		return fmt.Errorf("transaction %x is not in block %x", tp.transaction.ID(), tp.blockHash)
+	}
+	return nil
+}
+
+// find a mined transaction by id and prove its inclusion
+func (bc *Blockchain) TransactionProof(id [32]byte) (*TransactionProof, error) {
+	bc.mux.RLock()
+	defer bc.mux.RUnlock()
+	loc, ok := bc.blocks.byTx[id]
+	if !ok {
+		return nil, ErrTransactionNotFound
+	}
+	b := bc.chain[loc.height]
+	leaves := make([][32]byte, len(b.transactions))
+	for j, t := range b.transactions {
+		leaves[j] = t.Hash()
+	}
+	proof, err := NewMerkleProof(leaves, loc.index)
+	if err != nil {
+		return nil, err
+	}
+	return &TransactionProof{b.transactions[loc.index], b.Hash(), b.header.height, proof}, nil
+}
+
+func (tp *TransactionProof) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Transaction *Transaction `json:"transaction"`
+		BlockHash   string       `json:"blockHash"`
+		Height      uint64       `json:"height"`
+		Proof       *MerkleProof `json:"proof"`
+	}{
+		Transaction: tp.transaction,
+		BlockHash:   fmt.Sprintf("%x", tp.blockHash),
+		Height:      tp.height,
+		Proof:       tp.proof,
+	})
+}
+
+func (tp *TransactionProof) UnmarshalJSON(data []byte) error {
+	var v struct {
+		Transaction *Transaction `json:"transaction"`
+		BlockHash   string       `json:"blockHash"`
+		Height      uint64       `json:"height"`
+		Proof       *MerkleProof `json:"proof"`
+	}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	if v.Transaction == nil || v.Proof == nil {
+		return errors.New("missing transaction or proof")
+	}
+	if err := decodeHash(v.BlockHash, &tp.blockHash); err != nil {
+		return fmt.Errorf("invalid blockHash %q", v.BlockHash)
+	}
+	tp.transaction = v.Transaction
+	tp.height = v.Height
+	tp.proof = v.Proof
+	return nil
+}
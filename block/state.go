@@ -0,0 +1,128 @@
+package block
+
+import (
+	"encoding/json"
+
+	"github.com/nazeemnato/stonkcoin/utils"
+)
+
+// confirmed account state at the tip of the chain. the blockchain applies
+// every block to its ledger in place, a State reads that ledger under the
+// chain lock. each call answers for the tip at that moment, reads that have
+// to agree with each other go through View
+type State struct {
+	bc *Blockchain
+	// inside View, the read lock is held already
+	held bool
+}
+
+// view of the confirmed state
+func (bc *Blockchain) State() *State {
+	return &State{bc: bc}
+}
+
+// run fn on a state that stays at one tip, no block is applied and no reorg
+// happens until fn returns. fn must not call back into the blockchain
+func (bc *Blockchain) View(fn func(s *State)) {
+	bc.mux.RLock()
+	defer bc.mux.RUnlock()
+	fn(&State{bc: bc, held: true})
+}
+
+func (s *State) rlock() {
+	if !s.held {
+		s.bc.mux.RLock()
+	}
+}
+
+func (s *State) runlock() {
+	if !s.held {
+		s.bc.mux.RUnlock()
+	}
+}
+
+// height of the tip
+func (s *State) Height() uint64 {
+	s.rlock()
+	defer s.runlock()
+	return s.bc.height()
+}
+
+// confirmed balance of address
+func (s *State) Balance(address string) utils.Amount {
+	s.rlock()
+	defer s.runlock()
+	return s.bc.state.balances[address]
+}
+
+// coinbases paid to address that can't be spent in the next block yet
+func (s *State) Immature(address string) utils.Amount {
+	s.rlock()
+	defer s.runlock()
+	return s.bc.immature(address)
+}
+
+// what address can spend in the next block
+func (s *State) Spendable(address string) utils.Amount {
+	s.rlock()
+	defer s.runlock()
+	return s.bc.spendableBalance(address)
+}
+
+// confirmed transactions sent by address, which is the nonce its next
+// transaction must carry
+func (s *State) Nonce(address string) uint64 {
+	s.rlock()
+	defer s.runlock()
+	return s.bc.confirmedNonce(address)
+}
+
+// unspent output at o, nil if there is none
+func (s *State) UTXO(o OutPoint) *TxOutput {
+	s.rlock()
+	defer s.runlock()
+	return s.bc.state.utxos.Get(o)
+}
+
+// balances of address, all taken at the same height
+func (s *State) Account(address string) *AmountRespone {
+	s.rlock()
+	defer s.runlock()
+	total := s.bc.state.balances[address]
+	immature := s.bc.immature(address)
+	return &AmountRespone{Amount: total, Spendable: total - immature, Immature: immature}
+}
+
+// page of the transactions involving address, see Blockchain.History
+func (s *State) History(address string, offset int, limit int) *History {
+	s.rlock()
+	defer s.runlock()
+	return s.bc.history(address, offset, limit)
+}
+
+// unspent outputs of address that no pending transaction spends yet
+func (s *State) UTXOs(address string) []*UnspentOutput {
+	s.rlock()
+	defer s.runlock()
+	return s.bc.utxos(address)
+}
+
+func (s *State) MarshalJSON() ([]byte, error) {
+	s.rlock()
+	defer s.runlock()
+	return json.Marshal(struct {
+		Height   uint64 `json:"height"`
+		Accounts int    `json:"accounts"`
+		UTXOs    int    `json:"utxos"`
+	}{s.bc.height(), len(s.bc.state.balances), len(s.bc.state.utxos.outputs)})
+}
+
+// height of the tip, called with the lock held
+func (bc *Blockchain) height() uint64 {
+	return uint64(len(bc.chain) - 1)
+}
+
+// coinbases paid to address that can't be spent in the next block yet
+func (bc *Blockchain) immature(address string) utils.Amount {
+	return bc.state.immatureAt(address, bc.height()+1, bc.policy)
+}
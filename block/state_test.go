@@ -0,0 +1,31 @@
+package block
+
+import (
+	"testing"
+	"time"
+)
+
+// a block mined while a View is open is only applied once it returns
+func TestStateView(t *testing.T) {
+	_, a := testKey(t)
+	bc, err := NewBlockchainWithConfig(a, 0, Config{MiningWorkers: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer bc.Close()
+	mined := make(chan bool)
+	bc.View(func(s *State) {
+		height, balance := s.Height(), s.Balance(a)
+		go func() { mined <- bc.Mining() }()
+		time.Sleep(200 * time.Millisecond)
+		if s.Height() != height || s.Balance(a) != balance {
+			t.Errorf("state moved to height %d inside the view, want %d", s.Height(), height)
+		}
+	})
+	if !<-mined {
+		t.Fatal("no block mined")
+	}
+	if h := bc.State().Height(); h != 1 {
+		t.Errorf("height %d after the view, want 1", h)
+	}
+}
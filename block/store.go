@@ -0,0 +1,69 @@
+package block
+
+import "sync"
+
+// Store persists the blocks and the pending transactions of a blockchain
+type Store interface {
+	LoadBlocks() ([]*Block, error)
+	AppendBlock(b *Block) error
+	// replace the whole chain, used when a heavier chain wins consensus
+	ReplaceBlocks(blocks []*Block) error
+	LoadTransactions() ([]*PendingTransaction, error)
+	SaveTransactions(pending []*PendingTransaction) error
+	Close() error
+}
+
+// in memory store, nothing survives a restart
+type MemoryStore struct {
+	blocks       []*Block
+	transactions []*PendingTransaction
+	mux          sync.Mutex
+}
+
+// create new memory store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{}
+}
+
+func (ms *MemoryStore) LoadBlocks() ([]*Block, error) {
+	ms.mux.Lock()
+	defer ms.mux.Unlock()
+	blocks := make([]*Block, len(ms.blocks))
+	copy(blocks, ms.blocks)
+	return blocks, nil
+}
+
+func (ms *MemoryStore) AppendBlock(b *Block) error {
+	ms.mux.Lock()
+	defer ms.mux.Unlock()
+	ms.blocks = append(ms.blocks, b)
+	return nil
+}
+
+func (ms *MemoryStore) ReplaceBlocks(blocks []*Block) error {
+	ms.mux.Lock()
+	defer ms.mux.Unlock()
+	ms.blocks = make([]*Block, len(blocks))
+	copy(ms.blocks, blocks)
+	return nil
+}
+
+func (ms *MemoryStore) LoadTransactions() ([]*PendingTransaction, error) {
+	ms.mux.Lock()
+	defer ms.mux.Unlock()
+	pending := make([]*PendingTransaction, len(ms.transactions))
+	copy(pending, ms.transactions)
+	return pending, nil
+}
+
+func (ms *MemoryStore) SaveTransactions(pending []*PendingTransaction) error {
+	ms.mux.Lock()
+	defer ms.mux.Unlock()
+	ms.transactions = make([]*PendingTransaction, len(pending))
+	copy(ms.transactions, pending)
+	return nil
+}
+
+func (ms *MemoryStore) Close() error {
+	return nil
+}
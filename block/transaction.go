@@ -1,54 +1,334 @@
 package block
 
 import (
+	"crypto/ecdsa"
+	"crypto/sha256"
 	"encoding/json"
 	"fmt"
 	"strings"
+
+	"github.com/nazeemnato/stonkcoin/utils"
+)
+
+const (
+	TRANSACTION_TRANSFER = "transfer"
+	TRANSACTION_COINBASE = "coinbase"
+	// spends outputs of earlier utxo transactions, see utxo.go
+	TRANSACTION_UTXO = "utxo"
 )
 
 type Transaction struct {
+	txType           string
 	senderAddress    string
 	recipientAddress string
-	amount           float32
+	amount           utils.Amount
+	fee              utils.Amount
+	nonce            uint64
+	senderPublicKey  *ecdsa.PublicKey
+	signature        *utils.Signature
+	// only used by utxo transactions
+	inputs  []*TxInput
+	outputs []*TxOutput
 }
 
 type TransactionRequest struct {
-	SenderAddress   *string  `json:"sender_address"`
-	ReceiverAddress *string  `json:"receiver_address"`
-	SenderPublicKey *string  `json:"sender_public_key"`
-	Amount          *float32 `json:"amount"`
-	Signature       *string  `json:"signature"`
+	SenderAddress   *string       `json:"sender_address"`
+	ReceiverAddress *string       `json:"receiver_address"`
+	SenderPublicKey *string       `json:"sender_public_key"`
+	Amount          *utils.Amount `json:"amount"`
+	Fee             *utils.Amount `json:"fee,omitempty"`
+	Nonce           *uint64       `json:"nonce"`
+	Signature       *string       `json:"signature"`
 }
 
-func NewTransaction(senderAddress string, recipientAddress string, amount float32) *Transaction {
+// create new unsigned transfer, nonce is the sender's sequence number and fee
+// goes to the miner of the block that includes it
+func NewTransaction(senderAddress string, recipientAddress string, amount utils.Amount, fee utils.Amount, nonce uint64) *Transaction {
 	transactions := new(Transaction)
+	transactions.txType = TRANSACTION_TRANSFER
 	transactions.senderAddress = senderAddress
 	transactions.recipientAddress = recipientAddress
 	transactions.amount = amount
+	transactions.fee = fee
+	transactions.nonce = nonce
 	return transactions
 }
 
+// create new transfer carrying the sender's public key and signature
+func NewSignedTransaction(senderAddress string, recipientAddress string, amount utils.Amount, fee utils.Amount, nonce uint64, senderPublicKey *ecdsa.PublicKey, signature *utils.Signature) *Transaction {
+	t := NewTransaction(senderAddress, recipientAddress, amount, fee, nonce)
+	t.senderPublicKey = senderPublicKey
+	t.signature = signature
+	return t
+}
+
+// create new mining reward, paid out of thin air plus the fees of its block.
+// the nonce of a coinbase is the height of its block, which keeps reward ids
+// unique
+func NewCoinbaseTransaction(recipientAddress string, amount utils.Amount, height uint64) *Transaction {
+	t := NewTransaction(MINING_SENDER, recipientAddress, amount, 0, height)
+	t.txType = TRANSACTION_COINBASE
+	return t
+}
+
+func (t *Transaction) IsCoinbase() bool {
+	return t.txType == TRANSACTION_COINBASE
+}
+
+func (t *Transaction) IsUTXO() bool {
+	return t.txType == TRANSACTION_UTXO
+}
+
+func (t *Transaction) Type() string {
+	return t.txType
+}
+
+func (t *Transaction) SenderAddress() string {
+	return t.senderAddress
+}
+
+func (t *Transaction) RecipientAddress() string {
+	return t.recipientAddress
+}
+
+func (t *Transaction) Amount() utils.Amount {
+	return t.amount
+}
+
+func (t *Transaction) Fee() utils.Amount {
+	return t.fee
+}
+
+// what the sender account pays, amount plus fee. utxo transactions pay their
+// fee out of their inputs, the account only pays the deposit
+func (t *Transaction) Cost() (utils.Amount, error) {
+	if t.IsUTXO() {
+		return t.amount, nil
+	}
+	return t.amount.Add(t.fee)
+}
+
+// Cost of a transaction that is known to be valid
+func (t *Transaction) debit() utils.Amount {
+	cost, _ := t.Cost()
+	return cost
+}
+
+// account the transaction credits, utxo transactions only create outputs
+func (t *Transaction) creditsAccount() bool {
+	return !t.IsUTXO()
+}
+
+// utxo transactions without a deposit don't touch any account, each of them
+// is queued on its own
+func (t *Transaction) queueKey() string {
+	if t.senderAddress == "" {
+		return fmt.Sprintf("%x", t.ID())
+	}
+	return t.senderAddress
+}
+
+func (t *Transaction) Nonce() uint64 {
+	return t.nonce
+}
+
+// size of the transaction in bytes, which is what block space and fee
+// rates are measured in
+func (t *Transaction) Size() int {
+	m, _ := t.MarshalJSON()
+	return len(m)
+}
+
+// fee paid per 1000 bytes of block space
+func (t *Transaction) FeeRate() utils.Amount {
+	return FeeRate(t.fee, t.Size())
+}
+
+// transaction id, the hash of the signed payload
+func (t *Transaction) ID() [32]byte {
+	return sha256.Sum256(t.SigningPayload())
+}
+
+// hash of the whole transaction, signature and public key included. this is
+// what a block's merkle root commits to
+func (t *Transaction) Hash() [32]byte {
+	m, _ := t.MarshalJSON()
+	return sha256.Sum256(m)
+}
+
+func (t *Transaction) SenderPublicKey() *ecdsa.PublicKey {
+	return t.senderPublicKey
+}
+
+func (t *Transaction) Signature() *utils.Signature {
+	return t.signature
+}
+
+// bytes covered by the sender's signature
+//
+// this json marshal must be in the same order as wallet/wallet.go MarshalJSON()
+// otherwise, the signature will be invalid
+func (t *Transaction) SigningPayload() []byte {
+	if t.IsUTXO() {
+		return t.utxoSigningPayload()
+	}
+	m, _ := json.Marshal(struct {
+		SenderAddress    string       `json:"senderAddress"`
+		RecipientAddress string       `json:"recipientAddress"`
+		Amount           utils.Amount `json:"amount"`
+		Fee              utils.Amount `json:"fee,omitempty"`
+		Nonce            uint64       `json:"nonce"`
+	}{
+		SenderAddress:    t.senderAddress,
+		RecipientAddress: t.recipientAddress,
+		Amount:           t.amount,
+		Fee:              t.fee,
+		Nonce:            t.nonce,
+	})
+	return m
+}
+
+// check the signature and that the public key belongs to the sender address
+func (t *Transaction) Verify() error {
+	if t.IsCoinbase() {
+		return fmt.Errorf("coinbase transactions carry no signature")
+	}
+	if t.IsUTXO() {
+		return t.verifyUTXO()
+	}
+	return t.verifySender()
+}
+
+// check the signature of the sending account
+func (t *Transaction) verifySender() error {
+	if t.senderPublicKey == nil || t.signature == nil {
+		return fmt.Errorf("missing public key or signature")
+	}
+	if !t.senderPublicKey.Curve.IsOnCurve(t.senderPublicKey.X, t.senderPublicKey.Y) {
+		return fmt.Errorf("public key is not on the curve")
+	}
+	if utils.AddressFromPublicKey(t.senderPublicKey) != t.senderAddress {
+		return fmt.Errorf("public key does not belong to sender %s", t.senderAddress)
+	}
+	h := sha256.Sum256(t.SigningPayload())
+	if !ecdsa.Verify(t.senderPublicKey, h[:], t.signature.R, t.signature.S) {
+		return fmt.Errorf("invalid signature")
+	}
+	return nil
+}
+
 func (t *Transaction) Print() {
 	fmt.Printf("%s\n", strings.Repeat("-", 50))
+	fmt.Printf("id: %x\n", t.ID())
+	fmt.Printf("type: %s\n", t.txType)
 	fmt.Printf("senderAddress: %s\n", t.senderAddress)
 	fmt.Printf("recipientAddress: %s\n", t.recipientAddress)
-	fmt.Printf("amount: %.1f\n", t.amount)
+	fmt.Printf("amount: %s\n", t.amount)
+	if t.fee != 0 {
+		fmt.Printf("fee: %s\n", t.fee)
+	}
+	fmt.Printf("nonce: %d\n", t.nonce)
+	if t.signature != nil {
+		fmt.Printf("signature: %s\n", t.signature)
+	}
+	for _, in := range t.inputs {
+		fmt.Printf("input: %s\n", in.outPoint)
+	}
+	for _, out := range t.outputs {
+		fmt.Printf("output: %s to %s\n", out.amount, out.address)
+	}
 }
 
 func (t *Transaction) MarshalJSON() ([]byte, error) {
+	var publicKey, signature string
+	if t.senderPublicKey != nil {
+		publicKey = utils.PublicKeyString(t.senderPublicKey)
+	}
+	if t.signature != nil {
+		signature = t.signature.String()
+	}
 	return json.Marshal(struct {
-		SenderAddress    string  `json:"senderAddress"`
-		RecipientAddress string  `json:"recipientAddress"`
-		Amount           float32 `json:"amount"`
+		ID               string       `json:"id"`
+		Type             string       `json:"type"`
+		SenderAddress    string       `json:"senderAddress"`
+		RecipientAddress string       `json:"recipientAddress"`
+		Amount           utils.Amount `json:"amount"`
+		Fee              utils.Amount `json:"fee,omitempty"`
+		Nonce            uint64       `json:"nonce"`
+		SenderPublicKey  string       `json:"senderPublicKey,omitempty"`
+		Signature        string       `json:"signature,omitempty"`
+		Inputs           []*TxInput   `json:"inputs,omitempty"`
+		Outputs          []*TxOutput  `json:"outputs,omitempty"`
 	}{
+		ID:               fmt.Sprintf("%x", t.ID()),
+		Type:             t.txType,
 		SenderAddress:    t.senderAddress,
 		RecipientAddress: t.recipientAddress,
 		Amount:           t.amount,
+		Fee:              t.fee,
+		Nonce:            t.nonce,
+		SenderPublicKey:  publicKey,
+		Signature:        signature,
+		Inputs:           t.inputs,
+		Outputs:          t.outputs,
 	})
 }
 
+func (t *Transaction) UnmarshalJSON(data []byte) error {
+	// the id is derived, so it is not read back
+	var v struct {
+		Type             string       `json:"type"`
+		SenderAddress    string       `json:"senderAddress"`
+		RecipientAddress string       `json:"recipientAddress"`
+		Amount           utils.Amount `json:"amount"`
+		Fee              utils.Amount `json:"fee"`
+		Nonce            uint64       `json:"nonce"`
+		SenderPublicKey  string       `json:"senderPublicKey"`
+		Signature        string       `json:"signature"`
+		Inputs           []*TxInput   `json:"inputs"`
+		Outputs          []*TxOutput  `json:"outputs"`
+	}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	switch v.Type {
+	case TRANSACTION_TRANSFER, TRANSACTION_COINBASE, TRANSACTION_UTXO:
+	default:
+		return fmt.Errorf("unknown transaction type %q", v.Type)
+	}
+	t.txType = v.Type
+	t.senderAddress = v.SenderAddress
+	t.recipientAddress = v.RecipientAddress
+	t.amount = v.Amount
+	t.fee = v.Fee
+	t.nonce = v.Nonce
+	t.senderPublicKey = nil
+	t.signature = nil
+	t.inputs = nil
+	t.outputs = nil
+	if v.Type == TRANSACTION_UTXO {
+		t.inputs = v.Inputs
+		t.outputs = v.Outputs
+	}
+	if v.SenderPublicKey != "" {
+		publicKey, err := utils.ParsePublicKey(v.SenderPublicKey)
+		if err != nil {
+			return err
+		}
+		t.senderPublicKey = publicKey
+	}
+	if v.Signature != "" {
+		signature, err := utils.ParseSignature(v.Signature)
+		if err != nil {
+			return err
+		}
+		t.signature = signature
+	}
+	return nil
+}
+
 func (tr *TransactionRequest) Validate() bool {
-	if tr.SenderAddress == nil || tr.ReceiverAddress == nil || tr.Amount == nil || tr.Signature == nil {
+	if tr.SenderAddress == nil || tr.ReceiverAddress == nil || tr.SenderPublicKey == nil || tr.Amount == nil || tr.Nonce == nil || tr.Signature == nil {
 		return false
 	}
 	return true
@@ -0,0 +1,423 @@
+package block
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+
+	"github.com/nazeemnato/stonkcoin/utils"
+)
+
+// utxo transactions live next to account transfers. they spend outputs of
+// earlier utxo transactions, every input signed by the owner of its output,
+// and create new outputs. money enters the utxo side through a deposit, an
+// optional amount debited from a signing account like a transfer
+
+var (
+	ErrUnknownOutput = errors.New("input spends an unknown or already spent output")
+	ErrOutputPending = errors.New("output is already spent by a pending transaction")
+)
+
+// reference to the index-th output of a transaction
+type OutPoint struct {
+	txID  [32]byte
+	index uint32
+}
+
+func NewOutPoint(txID [32]byte, index uint32) OutPoint {
+	return OutPoint{txID, index}
+}
+
+func (o OutPoint) TxID() [32]byte {
+	return o.txID
+}
+
+func (o OutPoint) Index() uint32 {
+	return o.index
+}
+
+func (o OutPoint) String() string {
+	return fmt.Sprintf("%x:%d", o.txID, o.index)
+}
+
+// spends an output, signed by the key the output's address belongs to
+type TxInput struct {
+	outPoint  OutPoint
+	publicKey *ecdsa.PublicKey
+	signature *utils.Signature
+}
+
+func NewTxInput(outPoint OutPoint, publicKey *ecdsa.PublicKey, signature *utils.Signature) *TxInput {
+	return &TxInput{outPoint, publicKey, signature}
+}
+
+func (in *TxInput) OutPoint() OutPoint {
+	return in.outPoint
+}
+
+func (in *TxInput) PublicKey() *ecdsa.PublicKey {
+	return in.publicKey
+}
+
+func (in *TxInput) Signature() *utils.Signature {
+	return in.signature
+}
+
+func (in *TxInput) MarshalJSON() ([]byte, error) {
+	var publicKey, signature string
+	if in.publicKey != nil {
+		publicKey = utils.PublicKeyString(in.publicKey)
+	}
+	if in.signature != nil {
+		signature = in.signature.String()
+	}
+	return json.Marshal(struct {
+		TxID      string `json:"txId"`
+		Index     uint32 `json:"index"`
+		PublicKey string `json:"publicKey,omitempty"`
+		Signature string `json:"signature,omitempty"`
+	}{fmt.Sprintf("%x", in.outPoint.txID), in.outPoint.index, publicKey, signature})
+}
+
+func (in *TxInput) UnmarshalJSON(data []byte) error {
+	var v struct {
+		TxID      string `json:"txId"`
+		Index     uint32 `json:"index"`
+		PublicKey string `json:"publicKey"`
+		Signature string `json:"signature"`
+	}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	if err := decodeHash(v.TxID, &in.outPoint.txID); err != nil {
+		return fmt.Errorf("invalid input txId %q", v.TxID)
+	}
+	in.outPoint.index = v.Index
+	in.publicKey = nil
+	in.signature = nil
+	if v.PublicKey != "" {
+		publicKey, err := utils.ParsePublicKey(v.PublicKey)
+		if err != nil {
+			return err
+		}
+		in.publicKey = publicKey
+	}
+	if v.Signature != "" {
+		signature, err := utils.ParseSignature(v.Signature)
+		if err != nil {
+			return err
+		}
+		in.signature = signature
+	}
+	return nil
+}
+
+// amount locked to an address until an input spends it
+type TxOutput struct {
+	address string
+	amount  utils.Amount
+}
+
+func NewTxOutput(address string, amount utils.Amount) *TxOutput {
+	return &TxOutput{address, amount}
+}
+
+func (out *TxOutput) Address() string {
+	return out.address
+}
+
+func (out *TxOutput) Amount() utils.Amount {
+	return out.amount
+}
+
+func (out *TxOutput) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Address string       `json:"address"`
+		Amount  utils.Amount `json:"amount"`
+	}{out.address, out.amount})
+}
+
+func (out *TxOutput) UnmarshalJSON(data []byte) error {
+	var v struct {
+		Address string       `json:"address"`
+		Amount  utils.Amount `json:"amount"`
+	}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	out.address = v.Address
+	out.amount = v.Amount
+	return nil
+}
+
+// create new utxo transaction. senderAddress, deposit, nonce, senderPublicKey
+// and signature describe the optional deposit from an account and are left
+// empty without one. inputs and outputs minus the fee have to balance
+func NewUTXOTransaction(inputs []*TxInput, outputs []*TxOutput, fee utils.Amount, senderAddress string, deposit utils.Amount, nonce uint64, senderPublicKey *ecdsa.PublicKey, signature *utils.Signature) *Transaction {
+	t := NewSignedTransaction(senderAddress, "", deposit, fee, nonce, senderPublicKey, signature)
+	t.txType = TRANSACTION_UTXO
+	t.inputs = inputs
+	t.outputs = outputs
+	return t
+}
+
+func (t *Transaction) Inputs() []*TxInput {
+	return t.inputs
+}
+
+func (t *Transaction) Outputs() []*TxOutput {
+	return t.outputs
+}
+
+// bytes every input and the deposit sign
+//
+// this json marshal must be in the same order as wallet/utxo.go MarshalJSON()
+// otherwise, the signatures will be invalid
+func (t *Transaction) utxoSigningPayload() []byte {
+	type input struct {
+		TxID  string `json:"txId"`
+		Index uint32 `json:"index"`
+	}
+	type output struct {
+		Address string       `json:"address"`
+		Amount  utils.Amount `json:"amount"`
+	}
+	inputs := make([]input, len(t.inputs))
+	for i, in := range t.inputs {
+		inputs[i] = input{fmt.Sprintf("%x", in.outPoint.txID), in.outPoint.index}
+	}
+	outputs := make([]output, len(t.outputs))
+	for i, out := range t.outputs {
+		outputs[i] = output{out.address, out.amount}
+	}
+	var nonce *uint64
+	if t.senderAddress != "" {
+		nonce = &t.nonce
+	}
+	m, _ := json.Marshal(struct {
+		Type          string       `json:"type"`
+		SenderAddress string       `json:"senderAddress,omitempty"`
+		Amount        utils.Amount `json:"amount,omitempty"`
+		Fee           utils.Amount `json:"fee,omitempty"`
+		Nonce         *uint64      `json:"nonce,omitempty"`
+		Inputs        []input      `json:"inputs"`
+		Outputs       []output     `json:"outputs"`
+	}{TRANSACTION_UTXO, t.senderAddress, t.amount, t.fee, nonce, inputs, outputs})
+	return m
+}
+
+// check the form of a utxo transaction and all of its signatures. whether
+// the inputs exist and belong to the keys that signed them depends on the
+// utxo set, see checkUTXO
+func (t *Transaction) verifyUTXO() error {
+	if t.recipientAddress != "" {
+		return fmt.Errorf("utxo transactions pay to outputs, not a recipient")
+	}
+	if t.fee < 0 {
+		return ErrInvalidFee
+	}
+	if t.senderAddress != "" {
+		if t.amount <= 0 {
+			return fmt.Errorf("deposit must be positive")
+		}
+		if err := t.verifySender(); err != nil {
+			return err
+		}
+	} else if t.amount != 0 || t.senderPublicKey != nil || t.signature != nil {
+		return fmt.Errorf("deposit without a sender")
+	}
+	if len(t.inputs) == 0 && t.senderAddress == "" {
+		return fmt.Errorf("utxo transaction spends nothing")
+	}
+	if len(t.outputs) == 0 {
+		return fmt.Errorf("utxo transaction has no outputs")
+	}
+	for i, out := range t.outputs {
+		if out.amount <= 0 {
+			return fmt.Errorf("output %d: amount %s is not positive", i, out.amount)
+		}
+		if !utils.ValidAddress(out.address) {
+			return fmt.Errorf("output %d: invalid address %q", i, out.address)
+		}
+	}
+	h := sha256.Sum256(t.SigningPayload())
+	spent := make(map[OutPoint]bool)
+	for i, in := range t.inputs {
+		if spent[in.outPoint] {
+			return fmt.Errorf("input %d: spends %s twice", i, in.outPoint)
+		}
+		spent[in.outPoint] = true
+		if in.publicKey == nil || in.signature == nil {
+			return fmt.Errorf("input %d: missing public key or signature", i)
+		}
+		if !in.publicKey.Curve.IsOnCurve(in.publicKey.X, in.publicKey.Y) {
+			return fmt.Errorf("input %d: public key is not on the curve", i)
+		}
+		if !ecdsa.Verify(in.publicKey, h[:], in.signature.R, in.signature.S) {
+			return fmt.Errorf("input %d: invalid signature", i)
+		}
+	}
+	return nil
+}
+
+// check that every input spends an unspent output owned by its key and that
+// inputs plus deposit pay for outputs plus fee
+func checkUTXO(t *Transaction, utxos *UTXOSet) error {
+	in := t.amount
+	for i, input := range t.inputs {
+		out := utxos.Get(input.outPoint)
+		if out == nil {
+			return fmt.Errorf("input %d: %w: %s", i, ErrUnknownOutput, input.outPoint)
+		}
+		if input.publicKey == nil {
+			return fmt.Errorf("input %d: missing public key", i)
+		}
+		if utils.AddressFromPublicKey(input.publicKey) != out.address {
+			return fmt.Errorf("input %d: public key does not own %s", i, input.outPoint)
+		}
+		var err error
+		if in, err = in.Add(out.amount); err != nil {
+			return fmt.Errorf("input %d: %w", i, err)
+		}
+	}
+	out := t.fee
+	for i, output := range t.outputs {
+		var err error
+		if out, err = out.Add(output.amount); err != nil {
+			return fmt.Errorf("output %d: %w", i, err)
+		}
+	}
+	if in != out {
+		return fmt.Errorf("inputs and deposit of %s don't match outputs and fee of %s", in, out)
+	}
+	return nil
+}
+
+// unspent outputs of utxo transactions
+type UTXOSet struct {
+	outputs map[OutPoint]*TxOutput
+}
+
+func NewUTXOSet() *UTXOSet {
+	return &UTXOSet{make(map[OutPoint]*TxOutput)}
+}
+
+// unspent output at o, nil if it doesn't exist or was spent
+func (s *UTXOSet) Get(o OutPoint) *TxOutput {
+	return s.outputs[o]
+}
+
+// unspent outputs locked to address, ordered by outpoint
+func (s *UTXOSet) ByAddress(address string) []*UnspentOutput {
+	unspent := make([]*UnspentOutput, 0)
+	for o, out := range s.outputs {
+		if out.address == address {
+			unspent = append(unspent, &UnspentOutput{o, out})
+		}
+	}
+	sort.Slice(unspent, func(i, j int) bool {
+		a, b := unspent[i].OutPoint, unspent[j].OutPoint
+		if c := bytes.Compare(a.txID[:], b.txID[:]); c != 0 {
+			return c < 0
+		}
+		return a.index < b.index
+	})
+	return unspent
+}
+
+// output together with where to find it
+type UnspentOutput struct {
+	OutPoint OutPoint
+	Output   *TxOutput
+}
+
+func (u *UnspentOutput) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		TxID    string       `json:"txId"`
+		Index   uint32       `json:"index"`
+		Address string       `json:"address"`
+		Amount  utils.Amount `json:"amount"`
+	}{fmt.Sprintf("%x", u.OutPoint.txID), u.OutPoint.index, u.Output.address, u.Output.amount})
+}
+
+// unspent outputs of address that no pending transaction spends yet
+func (bc *Blockchain) UTXOs(address string) []*UnspentOutput {
+	return bc.State().UTXOs(address)
+}
+
+// UTXOs, called with the lock held
+func (bc *Blockchain) utxos(address string) []*UnspentOutput {
+	unspent := make([]*UnspentOutput, 0)
+	for _, u := range bc.state.utxos.ByAddress(address) {
+		if bc.mempool.Spender(u.OutPoint) == nil {
+			unspent = append(unspent, u)
+		}
+	}
+	return unspent
+}
+
+// add a signed utxo transaction to the pool. its inputs have to be confirmed
+// and not spent by another pending transaction
+func (bc *Blockchain) AddUTXOTransaction(t *Transaction) error {
+	bc.mux.Lock()
+	defer bc.mux.Unlock()
+	if !t.IsUTXO() {
+		return fmt.Errorf("not a utxo transaction")
+	}
+	if err := t.Verify(); err != nil {
+		log.Printf("Invalid transaction: %s\n", err)
+		return err
+	}
+	if t.Size() > MAX_BLOCK_SIZE/2 {
+		log.Printf("Error: %s\n", ErrTransactionTooLarge)
+		return ErrTransactionTooLarge
+	}
+	if _, ok := bc.mempool.Get(t.ID()); ok {
+		log.Printf("Error: %s\n", ErrDuplicate)
+		return ErrDuplicate
+	}
+	if err := checkUTXO(t, bc.state.utxos); err != nil {
+		log.Printf("Invalid transaction: %s\n", err)
+		return err
+	}
+	for _, in := range t.inputs {
+		if bc.mempool.Spender(in.outPoint) != nil {
+			log.Printf("Error: %s (%s)\n", ErrOutputPending, in.outPoint)
+			return fmt.Errorf("%w: %s", ErrOutputPending, in.outPoint)
+		}
+	}
+	if t.senderAddress != "" {
+		if bc.mempool.Conflict(t) != nil {
+			log.Printf("Error: %s\n", ErrConflict)
+			return ErrConflict
+		}
+		if next := bc.nextNonce(t.senderAddress); t.nonce != next {
+			log.Printf("Error: nonce %d, expected %d\n", t.nonce, next)
+			if t.nonce < next {
+				return fmt.Errorf("%w: got %d, expected %d", ErrNonceTooLow, t.nonce, next)
+			}
+			return fmt.Errorf("%w: got %d, expected %d", ErrNonceGap, t.nonce, next)
+		}
+		available := bc.spendableBalance(t.senderAddress) - bc.pendingSpend(t.senderAddress)
+		if available < t.amount {
+			log.Printf("Error: Not enough balance (%s available, %s requested)\n", available, t.amount)
+			return fmt.Errorf("%w: %s available, %s requested", ErrInsufficientBalance, available, t.amount)
+		}
+	}
+	evicted, err := bc.mempool.Add(t)
+	if err != nil {
+		log.Printf("Error: %s\n", err)
+		return err
+	}
+	for _, e := range evicted {
+		log.Printf("Evicted transaction %x\n", e.ID())
+	}
+	bc.saveTransactionPool()
+	bc.notifyChange()
+	return nil
+}
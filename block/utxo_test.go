@@ -0,0 +1,133 @@
+package block
+
+import (
+	"crypto/ecdsa"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/nazeemnato/stonkcoin/utils"
+)
+
+// utxo transaction spending outPoints, input i signed by keys[i]
+func testUTXOTransaction(outPoints []OutPoint, keys []*ecdsa.PrivateKey, outputs []*TxOutput, fee utils.Amount) *Transaction {
+	inputs := make([]*TxInput, len(outPoints))
+	for i, o := range outPoints {
+		inputs[i] = NewTxInput(o, &keys[i].PublicKey, nil)
+	}
+	t := NewUTXOTransaction(inputs, outputs, fee, "", 0, 0, nil, nil)
+	payload := t.SigningPayload()
+	for i, in := range t.inputs {
+		in.signature = testSignature(keys[i], payload)
+	}
+	return t
+}
+
+func TestValidateUTXO(t *testing.T) {
+	ka, a := testKey(t)
+	kb, b := testKey(t)
+	o1 := NewOutPoint([32]byte{1}, 0)
+	o2 := NewOutPoint([32]byte{2}, 1)
+	missing := NewOutPoint([32]byte{3}, 0)
+	pay := func(amount utils.Amount) []*TxOutput {
+		return []*TxOutput{NewTxOutput(b, amount)}
+	}
+	forged := testUTXOTransaction([]OutPoint{o1}, []*ecdsa.PrivateKey{kb}, pay(5*utils.COIN), 0)
+	forged.inputs[0].publicKey = &ka.PublicKey
+	tests := []struct {
+		name string
+		t    *Transaction
+		err  string
+	}{
+		{"spend", testUTXOTransaction([]OutPoint{o1}, []*ecdsa.PrivateKey{ka}, pay(5*utils.COIN), 0), ""},
+		{"two inputs with fee", testUTXOTransaction([]OutPoint{o1, o2}, []*ecdsa.PrivateKey{ka, ka}, pay(7*utils.COIN), utils.COIN), ""},
+		{"unknown output", testUTXOTransaction([]OutPoint{missing}, []*ecdsa.PrivateKey{ka}, pay(5*utils.COIN), 0), ErrUnknownOutput.Error()},
+		{"someone else's output", testUTXOTransaction([]OutPoint{o1}, []*ecdsa.PrivateKey{kb}, pay(5*utils.COIN), 0), "does not own"},
+		{"forged signature", forged, "invalid signature"},
+		{"spent twice", testUTXOTransaction([]OutPoint{o1, o1}, []*ecdsa.PrivateKey{ka, ka}, pay(10*utils.COIN), 0), "twice"},
+		{"pays out more", testUTXOTransaction([]OutPoint{o1}, []*ecdsa.PrivateKey{ka}, pay(5*utils.COIN+1), 0), "don't match"},
+		{"pays out less", testUTXOTransaction([]OutPoint{o1}, []*ecdsa.PrivateKey{ka}, pay(4*utils.COIN), 0), "don't match"},
+		{"no outputs", testUTXOTransaction([]OutPoint{o1}, []*ecdsa.PrivateKey{ka}, nil, 5*utils.COIN), "no outputs"},
+		{"invalid address", testUTXOTransaction([]OutPoint{o1}, []*ecdsa.PrivateKey{ka}, []*TxOutput{NewTxOutput("nobody", 5*utils.COIN)}, 0), "invalid address"},
+	}
+	for _, tt := range tests {
+		l := newLedger()
+		l.utxos.outputs[o1] = NewTxOutput(a, 5*utils.COIN)
+		l.utxos.outputs[o2] = NewTxOutput(a, 3*utils.COIN)
+		err := validateUTXO(tt.t, l)
+		if tt.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("%s: error %v, want %q", tt.name, err, tt.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %s", tt.name, err)
+			continue
+		}
+		for _, in := range tt.t.inputs {
+			if l.utxos.Get(in.outPoint) != nil {
+				t.Errorf("%s: %s is still unspent", tt.name, in.outPoint)
+			}
+		}
+		if out := l.utxos.Get(NewOutPoint(tt.t.ID(), 0)); out == nil || out.Address() != b {
+			t.Errorf("%s: output 0 was not added", tt.name)
+		}
+	}
+}
+
+func TestValidateUTXODeposit(t *testing.T) {
+	ka, a := testKey(t)
+	_, b := testKey(t)
+	deposit := func(amount utils.Amount, nonce uint64) *Transaction {
+		t := NewUTXOTransaction(nil, []*TxOutput{NewTxOutput(b, amount)}, 0, a, amount, nonce, &ka.PublicKey, nil)
+		t.signature = testSignature(ka, t.SigningPayload())
+		return t
+	}
+	tests := []struct {
+		name string
+		t    *Transaction
+		err  string
+	}{
+		{"deposit", deposit(2*utils.COIN, 0), ""},
+		{"more than the balance", deposit(2*utils.COIN+1, 0), ErrInsufficientBalance.Error()},
+		{"nonce", deposit(utils.COIN, 1), "out of sequence"},
+	}
+	for _, tt := range tests {
+		l := newLedger()
+		l.balances[a] = 2 * utils.COIN
+		err := validateUTXO(tt.t, l)
+		if tt.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("%s: error %v, want %q", tt.name, err, tt.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %s", tt.name, err)
+			continue
+		}
+		if l.balances[a] != 0 || l.nonces[a] != 1 {
+			t.Errorf("%s: balance %s and nonce %d after the deposit", tt.name, l.balances[a], l.nonces[a])
+		}
+	}
+}
+
+// a transaction read from disk may lack the public key of an input
+func TestCheckUTXOMissingPublicKey(t *testing.T) {
+	ka, a := testKey(t)
+	o := NewOutPoint([32]byte{1}, 0)
+	utxos := NewUTXOSet()
+	utxos.outputs[o] = NewTxOutput(a, utils.COIN)
+	tx := testUTXOTransaction([]OutPoint{o}, []*ecdsa.PrivateKey{ka}, []*TxOutput{NewTxOutput(a, utils.COIN)}, 0)
+	tx.inputs[0].publicKey = nil
+	if err := checkUTXO(tx, utxos); err == nil || !strings.Contains(err.Error(), "missing public key") {
+		t.Errorf("error %v, want a missing public key", err)
+	}
+	if err := tx.Verify(); err == nil {
+		t.Error("transaction without a public key verified")
+	}
+	if !errors.Is(checkUTXO(tx, NewUTXOSet()), ErrUnknownOutput) {
+		t.Error("unknown output not reported before the public key")
+	}
+}
@@ -0,0 +1,261 @@
+package block
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/nazeemnato/stonkcoin/utils"
+)
+
+// describes the first problem found while walking a chain
+type ValidationError struct {
+	Height int
+	// -1 when the block itself is bad rather than one of its transactions
+	TxIndex int
+	Reason  string
+}
+
+func (ve *ValidationError) Error() string {
+	if ve.TxIndex < 0 {
+		return fmt.Sprintf("block %d: %s", ve.Height, ve.Reason)
+	}
+	return fmt.Sprintf("block %d transaction %d: %s", ve.Height, ve.TxIndex, ve.Reason)
+}
+
+func (ve *ValidationError) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Height  int    `json:"height"`
+		TxIndex int    `json:"transactionIndex"`
+		Reason  string `json:"reason"`
+	}{
+		Height:  ve.Height,
+		TxIndex: ve.TxIndex,
+		Reason:  ve.Reason,
+	})
+}
+
+func blockError(height int, format string, a ...interface{}) *ValidationError {
+	return &ValidationError{height, -1, fmt.Sprintf(format, a...)}
+}
+
+func transactionError(height int, index int, format string, a ...interface{}) *ValidationError {
+	return &ValidationError{height, index, fmt.Sprintf(format, a...)}
+}
+
+// walk the whole chain and return the first inconsistency, nil if it is valid
+func (bc *Blockchain) Validate() error {
+	bc.mux.RLock()
+	defer bc.mux.RUnlock()
+	return ValidateChainWithPolicy(bc.chain, bc.policy)
+}
+
+// check that every block links to its predecessor, carries a valid proof of
+// work and only holds well formed transactions. the error is a
+// *ValidationError
+func ValidateChain(blocks []*Block) error {
+	return ValidateChainWithPolicy(blocks, DefaultMonetaryPolicy())
+}
+
+// same as ValidateChain, coinbases are checked against policy
+func ValidateChainWithPolicy(blocks []*Block, policy *MonetaryPolicy) error {
+	if _, _, err := validateChain(blocks, policy); err != nil {
+		return err
+	}
+	return nil
+}
+
+// validate blocks and return the ledger at their tip together with the undo
+// of every block, the genesis block's is empty
+func validateChain(blocks []*Block, policy *MonetaryPolicy) (*ledger, []*undo, *ValidationError) {
+	if len(blocks) == 0 {
+		return nil, nil, blockError(0, "chain is empty")
+	}
+	if blocks[0].Hash() != GenesisBlock().Hash() {
+		return nil, nil, blockError(0, "genesis block does not match")
+	}
+	// running balances and nonces, so a block can't spend more than its
+	// senders hold or replay an earlier transaction
+	l := newLedger()
+	undos := []*undo{newUndo()}
+	for i := 1; i < len(blocks); i++ {
+		u, err := l.applyBlock(blocks[:i], blocks[i], policy)
+		if err != nil {
+			return nil, nil, err
+		}
+		undos = append(undos, u)
+	}
+	return l, undos, nil
+}
+
+// check a header against the header it claims to extend, difficulty is what
+// NextHeaderDifficulty expects for it. used by light clients that only keep
+// headers
+func ValidateHeader(prev *BlockHeader, h *BlockHeader, difficulty uint32) error {
+	if err := validateHeader(prev, h, difficulty); err != nil {
+		return err
+	}
+	return nil
+}
+
+func validateHeader(prev *BlockHeader, h *BlockHeader, difficulty uint32) *ValidationError {
+	height := int(prev.height) + 1
+	if h.version != BLOCK_VERSION {
+		return blockError(height, "unknown version %d", h.version)
+	}
+	if h.height != prev.height+1 {
+		return blockError(height, "height %d does not follow %d", h.height, prev.height)
+	}
+	prevHash := prev.Hash()
+	if h.prevHash != prevHash {
+		return blockError(height, "prevHash %x does not match hash %x of block %d", h.prevHash, prevHash, prev.height)
+	}
+	if h.timestamp <= prev.timestamp {
+		return blockError(height, "timestamp %d is not after the previous block", h.timestamp)
+	}
+	if h.timestamp > time.Now().Add(MAX_FUTURE_BLOCK_TIME).UnixNano() {
+		return blockError(height, "timestamp %d is too far in the future", h.timestamp)
+	}
+	if h.difficulty != difficulty {
+		return blockError(height, "difficulty %d, expected %d", h.difficulty, difficulty)
+	}
+	if !h.ValidProof() {
+		return blockError(height, "nonce %d does not satisfy difficulty %d", h.nonce, h.difficulty)
+	}
+	return nil
+}
+
+// check a single block against the chain it claims to extend and apply its
+// transactions to the ledger, see ledger.applyBlock
+func validateBlock(chain []*Block, b *Block, l *ledger, policy *MonetaryPolicy) *ValidationError {
+	balances, nonces := l.balances, l.nonces
+	height := len(chain)
+	l.mature(uint64(height), policy)
+	if err := validateHeader(&chain[height-1].header, &b.header, NextDifficulty(chain)); err != nil {
+		return err
+	}
+	// a repeated transaction at the end of a level gives the same merkle
+	// root as the list without it (CVE-2012-2459)
+	seen := make(map[[32]byte]bool, len(b.transactions))
+	for i, t := range b.transactions {
+		if seen[t.ID()] {
+			return transactionError(height, i, "duplicate transaction %x", t.ID())
+		}
+		seen[t.ID()] = true
+	}
+	if root := TransactionsMerkleRoot(b.transactions); b.header.merkleRoot != root {
+		return blockError(height, "merkleRoot %x does not match transactions (%x)", b.header.merkleRoot, root)
+	}
+	if len(b.transactions) > MAX_BLOCK_TRANSACTIONS {
+		return blockError(height, "%d transactions, at most %d allowed", len(b.transactions), MAX_BLOCK_TRANSACTIONS)
+	}
+	if size := transactionsSize(b.transactions); size > MAX_BLOCK_SIZE {
+		return blockError(height, "transactions take %d bytes, at most %d allowed", size, MAX_BLOCK_SIZE)
+	}
+	fees, err := totalFees(b.transactions)
+	if err != nil {
+		return blockError(height, "fees: %s", err)
+	}
+	subsidy := policy.Subsidy(uint64(height))
+	reward, err := subsidy.Add(fees)
+	if err != nil {
+		return blockError(height, "mining reward: %s", err)
+	}
+	rewards := 0
+	for i, t := range b.transactions {
+		if t.IsUTXO() {
+			if err := validateUTXO(t, l); err != nil {
+				return transactionError(height, i, "%s", err)
+			}
+			continue
+		}
+		if t.amount <= 0 {
+			return transactionError(height, i, "amount %s is not positive", t.amount)
+		}
+		if t.fee < 0 {
+			return transactionError(height, i, "fee %s is negative", t.fee)
+		}
+		if !utils.ValidAddress(t.recipientAddress) {
+			return transactionError(height, i, "%s: %q", ErrInvalidRecipient, t.recipientAddress)
+		}
+		if t.IsCoinbase() != (t.senderAddress == MINING_SENDER) {
+			return transactionError(height, i, "only coinbase transactions may be sent from %s", MINING_SENDER)
+		}
+		if !t.IsCoinbase() {
+			if err := t.Verify(); err != nil {
+				return transactionError(height, i, "%s", err)
+			}
+			cost, err := t.Cost()
+			if err != nil {
+				return transactionError(height, i, "%s", err)
+			}
+			spendable := balances[t.senderAddress] - l.immature[t.senderAddress]
+			if spendable < cost {
+				return transactionError(height, i, "%s: %s can spend %s, spends %s", ErrInsufficientBalance, t.senderAddress, spendable, cost)
+			}
+			if t.nonce != nonces[t.senderAddress] {
+				return transactionError(height, i, "nonce %d out of sequence, expected %d", t.nonce, nonces[t.senderAddress])
+			}
+			// debit first, sending to yourself only costs the fee
+			l.setBalance(t.senderAddress, balances[t.senderAddress]-cost)
+			credited, err := balances[t.recipientAddress].Add(t.amount)
+			if err != nil {
+				return transactionError(height, i, "%s", err)
+			}
+			l.setBalance(t.recipientAddress, credited)
+			l.setNonce(t.senderAddress, nonces[t.senderAddress]+1)
+			continue
+		}
+		if t.signature != nil || t.senderPublicKey != nil {
+			return transactionError(height, i, "coinbase must not be signed")
+		}
+		if t.fee != 0 {
+			return transactionError(height, i, "coinbase must not pay a fee")
+		}
+		if t.nonce != uint64(height) {
+			return transactionError(height, i, "coinbase nonce %d does not match height", t.nonce)
+		}
+		rewards++
+		if rewards > 1 {
+			return transactionError(height, i, "more than one mining reward")
+		}
+		// claiming less than allowed is fine, the rest is never created
+		if t.amount > reward {
+			return transactionError(height, i, "mining reward %s exceeds subsidy %s plus %s in fees", t.amount, subsidy, fees)
+		}
+		credited, err := balances[t.recipientAddress].Add(t.amount)
+		if err != nil {
+			return transactionError(height, i, "%s", err)
+		}
+		l.setBalance(t.recipientAddress, credited)
+		l.credit(t.recipientAddress, t.amount, uint64(height))
+		l.supply += t.amount
+	}
+	// fees leave circulation, the coinbase brings back what it claims
+	l.supply -= fees
+	return nil
+}
+
+// check a utxo transaction against the ledger and apply it. outputs created
+// earlier in the same block can be spent
+func validateUTXO(t *Transaction, l *ledger) error {
+	if err := t.Verify(); err != nil {
+		return err
+	}
+	if err := checkUTXO(t, l.utxos); err != nil {
+		return err
+	}
+	if t.senderAddress != "" {
+		spendable := l.balances[t.senderAddress] - l.immature[t.senderAddress]
+		if spendable < t.amount {
+			return fmt.Errorf("%w: %s can spend %s, deposits %s", ErrInsufficientBalance, t.senderAddress, spendable, t.amount)
+		}
+		if t.nonce != l.nonces[t.senderAddress] {
+			return fmt.Errorf("nonce %d out of sequence, expected %d", t.nonce, l.nonces[t.senderAddress])
+		}
+		l.setBalance(t.senderAddress, l.balances[t.senderAddress]-t.amount)
+		l.setNonce(t.senderAddress, l.nonces[t.senderAddress]+1)
+	}
+	l.applyUTXO(t)
+	return nil
+}
@@ -0,0 +1,244 @@
+package block
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/nazeemnato/stonkcoin/utils"
+)
+
+func testKey(t *testing.T) (*ecdsa.PrivateKey, string) {
+	t.Helper()
+	k, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return k, utils.AddressFromPublicKey(&k.PublicKey)
+}
+
+func testSignature(k *ecdsa.PrivateKey, payload []byte) *utils.Signature {
+	h := sha256.Sum256(payload)
+	r, s, _ := ecdsa.Sign(rand.Reader, k, h[:])
+	return &utils.Signature{R: r, S: s}
+}
+
+// transfer signed by k
+func testSignedTransfer(k *ecdsa.PrivateKey, recipient string, amount utils.Amount, fee utils.Amount, nonce uint64) *Transaction {
+	t := NewTransaction(utils.AddressFromPublicKey(&k.PublicKey), recipient, amount, fee, nonce)
+	t.senderPublicKey = &k.PublicKey
+	t.signature = testSignature(k, t.SigningPayload())
+	return t
+}
+
+// block on top of chain paying reward the subsidy and the fees of
+// transactions, with a valid proof of work
+func testBlock(t *testing.T, chain []*Block, reward string, policy *MonetaryPolicy, transactions ...*Transaction) *Block {
+	t.Helper()
+	height := uint64(len(chain))
+	fees, err := totalFees(transactions)
+	if err != nil {
+		t.Fatal(err)
+	}
+	coinbase := NewCoinbaseTransaction(reward, policy.Subsidy(height)+fees, height)
+	b := NewBlock(height, chain[len(chain)-1].Hash(), append([]*Transaction{coinbase}, transactions...), NextDifficulty(chain))
+	nonce, ok := NewMiner(2).Solve(context.Background(), b.header)
+	if !ok {
+		t.Fatal("no proof of work found")
+	}
+	b.header.nonce = nonce
+	return b
+}
+
+// ledgers hold the same state, the coinbases still waiting to mature
+// included
+func sameLedger(t *testing.T, a, b *ledger) {
+	t.Helper()
+	a2, b2 := *a, *b
+	if len(a2.coinbases) == 0 {
+		a2.coinbases = nil
+	}
+	if len(b2.coinbases) == 0 {
+		b2.coinbases = nil
+	}
+	if !reflect.DeepEqual(&a2, &b2) {
+		t.Fatalf("ledgers differ:\n%+v\n%+v", a2, b2)
+	}
+}
+
+func TestValidateBlock(t *testing.T) {
+	policy := DefaultMonetaryPolicy()
+	policy.CoinbaseMaturity = 3
+	ka, a := testKey(t)
+	_, b := testKey(t)
+	_, m := testKey(t)
+	// a's coinbase at height 1 can be spent from height 4 on
+	chain := []*Block{GenesisBlock()}
+	chain = append(chain, testBlock(t, chain, a, policy))
+	for len(chain) < 4 {
+		chain = append(chain, testBlock(t, chain, m, policy))
+	}
+	tests := []struct {
+		name         string
+		height       int
+		transactions []*Transaction
+		err          string
+	}{
+		{"transfer", 4, []*Transaction{testSignedTransfer(ka, b, utils.COIN, 0, 0)}, ""},
+		{"two in sequence", 4, []*Transaction{
+			testSignedTransfer(ka, b, utils.COIN, 0, 0),
+			testSignedTransfer(ka, b, utils.COIN, utils.COIN/10, 1),
+		}, ""},
+		{"whole balance with fee", 4, []*Transaction{testSignedTransfer(ka, b, 9*utils.COIN, utils.COIN, 0)}, ""},
+		{"nonce ahead", 4, []*Transaction{testSignedTransfer(ka, b, utils.COIN, 0, 1)}, "out of sequence"},
+		{"nonce replayed", 4, []*Transaction{
+			testSignedTransfer(ka, b, utils.COIN, 0, 0),
+			testSignedTransfer(ka, b, 2*utils.COIN, 0, 0),
+		}, "out of sequence"},
+		{"more than the balance", 4, []*Transaction{testSignedTransfer(ka, b, 10*utils.COIN, 1, 0)}, ErrInsufficientBalance.Error()},
+		{"immature coinbase", 3, []*Transaction{testSignedTransfer(ka, b, utils.COIN, 0, 0)}, ErrInsufficientBalance.Error()},
+		{"spent earlier in the block", 4, []*Transaction{
+			testSignedTransfer(ka, b, 5*utils.COIN, 0, 0),
+			testSignedTransfer(ka, b, 5*utils.COIN+1, 0, 1),
+		}, ErrInsufficientBalance.Error()},
+		{"unsigned", 4, []*Transaction{NewTransaction(a, b, utils.COIN, 0, 0)}, "signature"},
+		{"malformed recipient", 4, []*Transaction{testSignedTransfer(ka, b[:len(b)-1], utils.COIN, 0, 0)}, ErrInvalidRecipient.Error()},
+		{"coinbase sender", 4, []*Transaction{NewTransaction(MINING_SENDER, b, utils.COIN, 0, 0)}, "only coinbase"},
+	}
+	for _, tt := range tests {
+		base := chain[:tt.height]
+		l, _, verr := validateChain(base, policy)
+		if verr != nil {
+			t.Fatal(verr)
+		}
+		before, _, _ := validateChain(base, policy)
+		_, err := l.applyBlock(base, testBlock(t, base, m, policy, tt.transactions...), policy)
+		if tt.err == "" {
+			if err != nil {
+				t.Errorf("%s: %s", tt.name, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("%s: error %v, want %q", tt.name, err, tt.err)
+			continue
+		}
+		// a rejected block leaves nothing behind
+		sameLedger(t, l, before)
+	}
+}
+
+func TestValidateBlockCoinbase(t *testing.T) {
+	policy := DefaultMonetaryPolicy()
+	_, m := testKey(t)
+	chain := []*Block{GenesisBlock()}
+	tests := []struct {
+		name     string
+		coinbase *Transaction
+		err      string
+	}{
+		{"subsidy", NewCoinbaseTransaction(m, policy.Subsidy(1), 1), ""},
+		{"less than the subsidy", NewCoinbaseTransaction(m, 1, 1), ""},
+		{"more than the subsidy", NewCoinbaseTransaction(m, policy.Subsidy(1)+1, 1), "exceeds subsidy"},
+		{"wrong height", NewCoinbaseTransaction(m, policy.Subsidy(1), 2), "does not match height"},
+	}
+	for _, tt := range tests {
+		b := NewBlock(1, chain[0].Hash(), []*Transaction{tt.coinbase}, NextDifficulty(chain))
+		b.header.nonce, _ = NewMiner(2).Solve(context.Background(), b.header)
+		_, err := newLedger().applyBlock(chain, b, policy)
+		if tt.err == "" {
+			if err != nil {
+				t.Errorf("%s: %s", tt.name, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("%s: error %v, want %q", tt.name, err, tt.err)
+		}
+	}
+}
+
+func TestValidateBlockHeader(t *testing.T) {
+	policy := DefaultMonetaryPolicy()
+	_, m := testKey(t)
+	chain := []*Block{GenesisBlock()}
+	tests := []struct {
+		name   string
+		tamper func(b *Block)
+		err    string
+	}{
+		{"valid", func(b *Block) {}, ""},
+		{"proof of work", func(b *Block) { b.header.nonce++ }, "does not satisfy difficulty"},
+		{"difficulty", func(b *Block) { b.header.difficulty-- }, "difficulty"},
+		{"merkle root", func(b *Block) { b.transactions = b.transactions[:0] }, "merkleRoot"},
+		{"prev hash", func(b *Block) { b.header.prevHash[0] ^= 1 }, "prevHash"},
+	}
+	for _, tt := range tests {
+		b := testBlock(t, chain, m, policy)
+		// the proof of work is checked last, the others fail before it
+		tt.tamper(b)
+		_, err := newLedger().applyBlock(chain, b, policy)
+		if tt.err == "" {
+			if err != nil {
+				t.Errorf("%s: %s", tt.name, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("%s: error %v, want %q", tt.name, err, tt.err)
+		}
+	}
+}
+
+// repeating the last of an odd number of transactions keeps the merkle root
+// and with it the block hash, the copy must not be mistaken for the block
+func TestValidateBlockDuplicateTransaction(t *testing.T) {
+	policy := DefaultMonetaryPolicy()
+	policy.CoinbaseMaturity = 1
+	ka, a := testKey(t)
+	_, b := testKey(t)
+	chain := []*Block{GenesisBlock()}
+	for len(chain) < 3 {
+		chain = append(chain, testBlock(t, chain, a, policy))
+	}
+	l, _, verr := validateChain(chain, policy)
+	if verr != nil {
+		t.Fatal(verr)
+	}
+	blk := testBlock(t, chain, a, policy, testSignedTransfer(ka, b, utils.COIN, 0, 0), testSignedTransfer(ka, b, utils.COIN, 0, 1))
+	hash := blk.Hash()
+	blk.transactions = append(blk.transactions, blk.transactions[2])
+	if blk.Hash() != hash {
+		t.Fatal("repeating the last transaction changed the block hash")
+	}
+	if _, err := l.applyBlock(chain, blk, policy); err == nil || !strings.Contains(err.Error(), "duplicate transaction") {
+		t.Errorf("error %v, want a duplicate transaction", err)
+	}
+}
+
+// a valid chain gives a nil error, not a nil *ValidationError inside one
+func TestValidateChainError(t *testing.T) {
+	policy := DefaultMonetaryPolicy()
+	_, a := testKey(t)
+	chain := []*Block{GenesisBlock()}
+	chain = append(chain, testBlock(t, chain, a, policy))
+	if err := ValidateChainWithPolicy(chain, policy); err != nil {
+		t.Fatalf("valid chain rejected: %v", err)
+	}
+	bad := *chain[1]
+	bad.header.prevHash = [32]byte{1}
+	err := ValidateChainWithPolicy([]*Block{chain[0], &bad}, policy)
+	var ve *ValidationError
+	if !errors.As(err, &ve) {
+		t.Fatalf("error %v is not a *ValidationError", err)
+	}
+	if ve.Height != 1 || ve.TxIndex != -1 {
+		t.Errorf("error at block %d transaction %d, want block 1", ve.Height, ve.TxIndex)
+	}
+}
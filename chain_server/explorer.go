@@ -0,0 +1,199 @@
+package main
+
+import (
+	"embed"
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/nazeemnato/stonkcoin/block"
+	"github.com/nazeemnato/stonkcoin/utils"
+)
+
+const (
+	EXPLORER_LATEST_BLOCKS = 20
+	EXPLORER_PAGE_SIZE     = 25
+)
+
+// pages are compiled into the binary, the explorer works wherever the node
+// is started from and loads nothing from the internet
+//
+//go:embed templates/*.html
+var explorerFiles embed.FS
+
+var explorerTemplates = template.Must(template.New("").Funcs(template.FuncMap{
+	"hex": func(h [32]byte) string {
+		return fmt.Sprintf("%x", h)
+	},
+	"short": func(h [32]byte) string {
+		return fmt.Sprintf("%x", h[:6])
+	},
+	"time": func(ns int64) string {
+		return time.Unix(0, ns).UTC().Format("2006-01-02 15:04:05 UTC")
+	},
+	"prev": func(height uint64) uint64 {
+		return height - 1
+	},
+	"next": func(height uint64) uint64 {
+		return height + 1
+	},
+	"owner": func(in *block.TxInput) string {
+		if in.PublicKey() == nil {
+			return ""
+		}
+		return utils.AddressFromPublicKey(in.PublicKey())
+	},
+}).ParseFS(explorerFiles, "templates/*.html"))
+
+// everything a page may show, each page only fills what it needs
+type explorerPage struct {
+	Title   string
+	Message string
+
+	Summary      *block.ChainSummary
+	Blocks       []*block.Block
+	Block        *block.Block
+	Transaction  *block.TransactionInfo
+	Transactions []*block.Transaction
+
+	Address string
+	Balance *block.AmountRespone
+	History *block.History
+	UTXOs   []*block.UnspentOutput
+	// offsets of the neighbouring history pages, -1 if there is none
+	Prev int
+	Next int
+}
+
+func (s *Server) render(w http.ResponseWriter, status int, name string, page *explorerPage) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	if err := explorerTemplates.ExecuteTemplate(w, name, page); err != nil {
+		log.Printf("Error rendering %s: %s\n", name, err)
+	}
+}
+
+func (s *Server) notFound(w http.ResponseWriter, message string) {
+	s.render(w, http.StatusNotFound, "notfound.html", &explorerPage{Title: "Not found", Message: message})
+}
+
+func (s *Server) ExplorerIndex(w http.ResponseWriter, req *http.Request) {
+	if req.URL.Path != "/explorer/" {
+		s.notFound(w, "There is no such page.")
+		return
+	}
+	bc := s.GetBlockchain()
+	s.render(w, http.StatusOK, "index.html", &explorerPage{
+		Title:   "Blocks",
+		Summary: bc.Summary(),
+		Blocks:  bc.LatestBlocks(EXPLORER_LATEST_BLOCKS),
+	})
+}
+
+func (s *Server) ExplorerBlock(w http.ResponseWriter, req *http.Request) {
+	bc := s.GetBlockchain()
+	query := req.URL.Query()
+	var b *block.Block
+	if hash, ok := parseID(query.Get("hash")); ok {
+		b = bc.BlockByHash(hash)
+	} else if height, err := strconv.ParseUint(query.Get("height"), 10, 64); err == nil {
+		b = bc.BlockByHeight(height)
+	}
+	if b == nil {
+		s.notFound(w, "The block is not on the chain.")
+		return
+	}
+	s.render(w, http.StatusOK, "block.html", &explorerPage{
+		Title:   fmt.Sprintf("Block %d", b.Height()),
+		Summary: bc.Summary(),
+		Block:   b,
+	})
+}
+
+func (s *Server) ExplorerTransaction(w http.ResponseWriter, req *http.Request) {
+	id, ok := parseID(req.URL.Query().Get("id"))
+	if !ok {
+		s.notFound(w, "That is not a transaction id.")
+		return
+	}
+	info := s.GetBlockchain().FindTransaction(id)
+	if info == nil {
+		s.notFound(w, "The transaction is neither mined nor pending.")
+		return
+	}
+	s.render(w, http.StatusOK, "transaction.html", &explorerPage{
+		Title:       "Transaction",
+		Transaction: info,
+	})
+}
+
+func (s *Server) ExplorerAddress(w http.ResponseWriter, req *http.Request) {
+	query := req.URL.Query()
+	address := query.Get("address")
+	if !utils.ValidAddress(address) {
+		s.notFound(w, "That is not a valid address.")
+		return
+	}
+	offset, err := strconv.Atoi(query.Get("offset"))
+	if err != nil || offset < 0 {
+		offset = 0
+	}
+	page := &explorerPage{
+		Title:   "Address",
+		Address: address,
+		Prev:    -1,
+		Next:    -1,
+	}
+	// balance, history and outputs from the same tip
+	s.GetBlockchain().View(func(st *block.State) {
+		page.Balance = st.Account(address)
+		page.History = st.History(address, offset, EXPLORER_PAGE_SIZE)
+		page.UTXOs = st.UTXOs(address)
+	})
+	if offset > 0 {
+		page.Prev = offset - EXPLORER_PAGE_SIZE
+		if page.Prev < 0 {
+			page.Prev = 0
+		}
+	}
+	if offset+len(page.History.Entries) < page.History.Total {
+		page.Next = offset + len(page.History.Entries)
+	}
+	s.render(w, http.StatusOK, "address.html", page)
+}
+
+func (s *Server) ExplorerMempool(w http.ResponseWriter, req *http.Request) {
+	bc := s.GetBlockchain()
+	s.render(w, http.StatusOK, "mempool.html", &explorerPage{
+		Title:        "Mempool",
+		Summary:      bc.Summary(),
+		Transactions: bc.TransactionPool(),
+	})
+}
+
+// jump to whatever q names: a height, a block hash, a transaction id or an
+// address
+func (s *Server) ExplorerSearch(w http.ResponseWriter, req *http.Request) {
+	q := req.URL.Query().Get("q")
+	bc := s.GetBlockchain()
+	if _, err := strconv.ParseUint(q, 10, 64); err == nil {
+		http.Redirect(w, req, "/explorer/block?height="+q, http.StatusFound)
+		return
+	}
+	if id, ok := parseID(q); ok {
+		if bc.BlockByHash(id) != nil {
+			http.Redirect(w, req, "/explorer/block?hash="+q, http.StatusFound)
+			return
+		}
+		http.Redirect(w, req, "/explorer/transaction?id="+q, http.StatusFound)
+		return
+	}
+	if utils.ValidAddress(q) {
+		http.Redirect(w, req, "/explorer/address?address="+q, http.StatusFound)
+		return
+	}
+	s.notFound(w, "Nothing matches your search.")
+}
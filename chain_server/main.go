@@ -1,42 +1,110 @@
 package main
 
 import (
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"io"
 	"log"
+	"net"
 	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
 
 	"github.com/nazeemnato/stonkcoin/block"
+	"github.com/nazeemnato/stonkcoin/peer"
 	"github.com/nazeemnato/stonkcoin/utils"
 	"github.com/nazeemnato/stonkcoin/wallet"
 )
 
+const (
+	// most headers served per /headers request
+	MAX_HEADERS = 2000
+	// passphrase sealing the node's reward wallet the first time it starts
+	NODE_PASSPHRASE_ENV = "STONKCOIN_NODE_PASSPHRASE"
+	// least time between two rounds of fetching the peers' chains
+	RESOLVE_COOLDOWN = 10 * time.Second
+)
+
+var errResolveThrottled = errors.New("consensus ran moments ago or is still running")
+
 var cache map[string]*block.Blockchain = make(map[string]*block.Blockchain)
 
 type Server struct {
-	port uint16
+	port    uint16
+	dataDir string
+	config  block.Config
+	reward  string
+	peers   *peer.Peers
+	// a single consensus round at a time, at most one per RESOLVE_COOLDOWN
+	resolving   bool
+	lastResolve time.Time
+	resolveMux  sync.Mutex
 }
 
-func NewServer(port uint16) *Server {
-	return &Server{port}
+// self is the url other nodes reach this one at. mining rewards go to reward,
+// or to the node's own wallet in dataDir when it is empty
+func NewServer(port uint16, dataDir string, self string, reward string, config block.Config) *Server {
+	return &Server{port: port, dataDir: dataDir, config: config, reward: reward, peers: peer.NewPeers(self)}
 }
 
 func (s *Server) Port() uint16 {
 	return s.port
 }
 
+func (s *Server) Peers() *peer.Peers {
+	return s.peers
+}
+
 func (s *Server) GetBlockchain() *block.Blockchain {
 	bc, ok := cache["blockchain"]
 	if !ok {
-		wallet := wallet.NewWallet()
-		bc = block.NewBlockchain(wallet.Address(), s.port)
+		config := s.config
+		if s.dataDir != "" {
+			store, err := block.NewFileStore(s.dataDir)
+			if err != nil {
+				log.Fatalf("Error opening data directory: %s\n", err)
+			}
+			config.Store = store
+		}
+		address := s.reward
+		if address == "" && s.dataDir == "" {
+			// nowhere to keep a wallet, its key is gone once the node exits
+			address = wallet.NewWallet().Address()
+			log.Printf("Warning: no -reward and no -data, mining rewards go to %s whose key is only kept in memory\n", address)
+		} else if address == "" {
+			// keep the node's wallet next to the chain, its rewards stay
+			// spendable across restarts
+			a, created, err := wallet.NodeAddress(s.dataDir, os.Getenv(NODE_PASSPHRASE_ENV))
+			if err != nil {
+				log.Fatalf("Error loading node wallet (set %s or pass -reward): %s\n", NODE_PASSPHRASE_ENV, err)
+			}
+			if created {
+				log.Printf("Created node wallet in %s\n", filepath.Join(s.dataDir, wallet.NODE_KEYSTORE_DIR))
+			}
+			address = a
+		}
+		var err error
+		bc, err = block.NewBlockchainWithConfig(address, s.port, config)
+		if err != nil {
+			log.Fatalf("Error loading blockchain: %s\n", err)
+		}
 		cache["blockchain"] = bc
+		// gossip every block we mine or accept
+		bc.OnNewBlock(func(b *block.Block) {
+			m, _ := b.MarshalJSON()
+			s.peers.Broadcast("/block", m, "")
+		})
 
-		log.Printf("Created new blockchain with address: %s\n", wallet.Address())
-		log.Printf("Public key: %s\n", wallet.PublicKeyStr())
-		log.Printf("Private key: %s\n", wallet.PrivateKeyStr())
+		log.Printf("Blockchain loaded, mining rewards go to %s\n", address)
 	}
 	return bc
 }
@@ -54,6 +122,36 @@ func (s *Server) GetChain(w http.ResponseWriter, req *http.Request) {
 	}
 }
 
+func (s *Server) ValidateChain(w http.ResponseWriter, req *http.Request) {
+	switch req.Method {
+	case http.MethodGet:
+		w.Header().Set("Content-Type", "application/json")
+		bc := s.GetBlockchain()
+		var m []byte
+		if err := bc.Validate(); err != nil {
+			log.Printf("Chain validation failed: %s\n", err)
+			// where the chain broke when it is known, the message otherwise
+			var reason interface{} = err.Error()
+			var ve *block.ValidationError
+			if errors.As(err, &ve) {
+				reason = ve
+			}
+			m, _ = json.Marshal(struct {
+				Valid bool        `json:"valid"`
+				Error interface{} `json:"error"`
+			}{false, reason})
+		} else {
+			m, _ = json.Marshal(struct {
+				Valid bool `json:"valid"`
+			}{true})
+		}
+		io.WriteString(w, string(m))
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		log.Printf("Method not allowed: %s", req.Method)
+	}
+}
+
 func (s *Server) Transaction(w http.ResponseWriter, req *http.Request) {
 	switch req.Method {
 	case http.MethodGet:
@@ -78,20 +176,45 @@ func (s *Server) Transaction(w http.ResponseWriter, req *http.Request) {
 			return
 		}
 
-		publicKey := utils.PublicKeyFromString(*t.SenderPublicKey)
-		signature := utils.SignatureFromString(*t.Signature)
+		if !t.Validate() {
+			log.Println("Missing fields")
+			w.WriteHeader(http.StatusBadRequest)
+			io.WriteString(w, string(utils.Json("Missing fields")))
+			return
+		}
+		publicKey, err := utils.ParsePublicKey(*t.SenderPublicKey)
+		if err != nil {
+			log.Printf("Error decoding public key: %s\n", err)
+			w.WriteHeader(http.StatusBadRequest)
+			io.WriteString(w, string(utils.Json("Invalid public key")))
+			return
+		}
+		signature, err := utils.ParseSignature(*t.Signature)
+		if err != nil {
+			log.Printf("Error decoding signature: %s\n", err)
+			w.WriteHeader(http.StatusBadRequest)
+			io.WriteString(w, string(utils.Json("Invalid signature")))
+			return
+		}
 
+		// the fee is optional, no fee field means no fee
+		var fee utils.Amount
+		if t.Fee != nil {
+			fee = *t.Fee
+		}
 		bc := s.GetBlockchain()
-		isCreated := bc.CreateTransaction(*t.SenderAddress, *t.ReceiverAddress, *t.Amount, publicKey, signature)
+		err = bc.CreateTransaction(*t.SenderAddress, *t.ReceiverAddress, *t.Amount, fee, *t.Nonce, publicKey, signature)
 
 		w.Header().Set("Content-Type", "application/json")
 		var m []byte
-		if !isCreated {
+		if err != nil {
 			w.WriteHeader(http.StatusBadRequest)
-			m = utils.Json("Transaction not created")
+			m = utils.Json(fmt.Sprintf("Transaction not created: %s", err))
 		} else {
 			w.WriteHeader(http.StatusCreated)
 			m = utils.Json("Transaction created")
+			relay, _ := json.Marshal(t)
+			s.peers.Broadcast("/transaction", relay, req.Header.Get(peer.PEER_HEADER))
 		}
 		io.WriteString(w, string(m))
 	default:
@@ -104,14 +227,58 @@ func (s *Server) Mine(w http.ResponseWriter, req *http.Request) {
 	switch req.Method {
 	case http.MethodGet:
 		w.Header().Set("Content-Type", "application/json")
-		bc := s.GetBlockchain()
-		isMined := bc.Mining()
-		var m []byte
-		if !isMined {
+		b, err := s.GetBlockchain().MiningController().MineOnce(req.Context())
+		if errors.Is(err, block.ErrMiningBusy) {
+			// /mine/status would report both searches as one
+			w.WriteHeader(http.StatusConflict)
+			io.WriteString(w, string(utils.Json(err.Error())))
+			return
+		}
+		if err != nil {
+			log.Printf("Error mining block: %s\n", err)
+			w.WriteHeader(http.StatusBadRequest)
+			io.WriteString(w, string(utils.Json("Block not mined")))
+			return
+		}
+		log.Printf("Mined block %d with %d transactions\n", b.Height(), len(b.Transactions()))
+		io.WriteString(w, string(utils.Json("Block mined")))
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		log.Printf("Method not allowed: %s", req.Method)
+	}
+}
+
+// start background mining, interval and address query parameters change the
+// pause between blocks and who gets the reward
+func (s *Server) StartMining(w http.ResponseWriter, req *http.Request) {
+	switch req.Method {
+	case http.MethodGet:
+		w.Header().Set("Content-Type", "application/json")
+		controller := s.GetBlockchain().MiningController()
+		query := req.URL.Query()
+		interval, err := time.ParseDuration(query.Get("interval"))
+		if query.Get("interval") != "" && (err != nil || interval < 0) {
+			w.WriteHeader(http.StatusBadRequest)
+			io.WriteString(w, string(utils.Json("Invalid interval")))
+			return
+		}
+		address := query.Get("address")
+		if address != "" && !utils.ValidAddress(address) {
 			w.WriteHeader(http.StatusBadRequest)
-			m = utils.Json("Block not mined")
+			io.WriteString(w, string(utils.Json("Invalid address")))
+			return
+		}
+		if query.Get("interval") != "" {
+			controller.SetInterval(interval)
+		}
+		if address != "" {
+			controller.SetRewardAddress(address)
+		}
+		var m []byte
+		if controller.Start() {
+			m = utils.Json("Mining started")
 		} else {
-			m = utils.Json("Block mined")
+			m = utils.Json("Mining already running")
 		}
 		io.WriteString(w, string(m))
 	default:
@@ -120,13 +287,58 @@ func (s *Server) Mine(w http.ResponseWriter, req *http.Request) {
 	}
 }
 
-func (s *Server) StartMining(w http.ResponseWriter, req *http.Request) {
+func (s *Server) StopMining(w http.ResponseWriter, req *http.Request) {
 	switch req.Method {
 	case http.MethodGet:
 		w.Header().Set("Content-Type", "application/json")
-		bc := s.GetBlockchain()
-		bc.StartMining()
-		m := utils.Json("Mining started")
+		var m []byte
+		if s.GetBlockchain().MiningController().Stop() {
+			m = utils.Json("Mining stopped")
+		} else {
+			m = utils.Json("Mining not running")
+		}
+		io.WriteString(w, string(m))
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		log.Printf("Method not allowed: %s", req.Method)
+	}
+}
+
+func (s *Server) PauseMining(w http.ResponseWriter, req *http.Request) {
+	switch req.Method {
+	case http.MethodGet:
+		w.Header().Set("Content-Type", "application/json")
+		var m []byte
+		if s.GetBlockchain().MiningController().Pause() {
+			m = utils.Json("Mining paused")
+		} else {
+			m = utils.Json("Mining not running")
+		}
+		io.WriteString(w, string(m))
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		log.Printf("Method not allowed: %s", req.Method)
+	}
+}
+
+func (s *Server) MiningStatus(w http.ResponseWriter, req *http.Request) {
+	switch req.Method {
+	case http.MethodGet:
+		w.Header().Set("Content-Type", "application/json")
+		m, _ := s.GetBlockchain().MiningController().Status().MarshalJSON()
+		io.WriteString(w, string(m))
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		log.Printf("Method not allowed: %s", req.Method)
+	}
+}
+
+// fee rates paid in recent blocks
+func (s *Server) FeeEstimate(w http.ResponseWriter, req *http.Request) {
+	switch req.Method {
+	case http.MethodGet:
+		w.Header().Set("Content-Type", "application/json")
+		m, _ := s.GetBlockchain().EstimateFee().MarshalJSON()
 		io.WriteString(w, string(m))
 	default:
 		w.WriteHeader(http.StatusMethodNotAllowed)
@@ -139,9 +351,521 @@ func (s *Server) AccountBalance(w http.ResponseWriter, req *http.Request) {
 	case http.MethodGet:
 		w.Header().Set("Content-Type", "application/json")
 		address := req.URL.Query().Get("address")
-		amount := s.GetBlockchain().CalculateTransaction(address)
-		res := &block.AmountRespone{Amount: amount}
-		m, _ := res.MarshalJSON()
+		m, _ := s.GetBlockchain().Balance(address).MarshalJSON()
+		io.WriteString(w, string(m))
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		log.Printf("Method not allowed: %s", req.Method)
+	}
+}
+
+func (s *Server) AccountTransactions(w http.ResponseWriter, req *http.Request) {
+	switch req.Method {
+	case http.MethodGet:
+		w.Header().Set("Content-Type", "application/json")
+		query := req.URL.Query()
+		address := query.Get("address")
+		if !utils.ValidAddress(address) {
+			w.WriteHeader(http.StatusBadRequest)
+			io.WriteString(w, string(utils.Json("Invalid address")))
+			return
+		}
+		offset, err := strconv.Atoi(query.Get("offset"))
+		if err != nil {
+			offset = 0
+		}
+		limit, err := strconv.Atoi(query.Get("limit"))
+		if err != nil {
+			limit = block.HISTORY_PAGE_SIZE
+		}
+		m, _ := s.GetBlockchain().History(address, offset, limit).MarshalJSON()
+		io.WriteString(w, string(m))
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		log.Printf("Method not allowed: %s", req.Method)
+	}
+}
+
+func writeBlocks(w http.ResponseWriter, blocks []*block.Block) {
+	m, _ := json.Marshal(struct {
+		Blocks []*block.Block `json:"blocks"`
+		Length int            `json:"length"`
+	}{
+		blocks,
+		len(blocks),
+	})
+	io.WriteString(w, string(m))
+}
+
+func (s *Server) Blocks(w http.ResponseWriter, req *http.Request) {
+	switch req.Method {
+	case http.MethodGet:
+		w.Header().Set("Content-Type", "application/json")
+		from, err := strconv.ParseUint(req.URL.Query().Get("from"), 10, 64)
+		if err != nil {
+			from = 0
+		}
+		limit, err := strconv.Atoi(req.URL.Query().Get("limit"))
+		if err != nil {
+			limit = block.MAX_BLOCKS_PAGE
+		}
+		writeBlocks(w, s.GetBlockchain().Blocks(from, limit))
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		log.Printf("Method not allowed: %s", req.Method)
+	}
+}
+
+func (s *Server) LatestBlocks(w http.ResponseWriter, req *http.Request) {
+	switch req.Method {
+	case http.MethodGet:
+		w.Header().Set("Content-Type", "application/json")
+		n, err := strconv.Atoi(req.URL.Query().Get("n"))
+		if err != nil {
+			n = 10
+		}
+		writeBlocks(w, s.GetBlockchain().LatestBlocks(n))
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		log.Printf("Method not allowed: %s", req.Method)
+	}
+}
+
+func (s *Server) TransactionLookup(w http.ResponseWriter, req *http.Request) {
+	switch req.Method {
+	case http.MethodGet:
+		w.Header().Set("Content-Type", "application/json")
+		id, ok := parseID(req.URL.Query().Get("id"))
+		if !ok {
+			w.WriteHeader(http.StatusBadRequest)
+			io.WriteString(w, string(utils.Json("Invalid transaction id")))
+			return
+		}
+		info := s.GetBlockchain().FindTransaction(id)
+		if info == nil {
+			w.WriteHeader(http.StatusNotFound)
+			io.WriteString(w, string(utils.Json("Transaction not found")))
+			return
+		}
+		m, _ := info.MarshalJSON()
+		io.WriteString(w, string(m))
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		log.Printf("Method not allowed: %s", req.Method)
+	}
+}
+
+func (s *Server) ChainSummary(w http.ResponseWriter, req *http.Request) {
+	switch req.Method {
+	case http.MethodGet:
+		w.Header().Set("Content-Type", "application/json")
+		m, _ := s.GetBlockchain().Summary().MarshalJSON()
+		io.WriteString(w, string(m))
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		log.Printf("Method not allowed: %s", req.Method)
+	}
+}
+
+func (s *Server) Block(w http.ResponseWriter, req *http.Request) {
+	switch req.Method {
+	case http.MethodGet:
+		w.Header().Set("Content-Type", "application/json")
+		query := req.URL.Query()
+		var b *block.Block
+		if hash := query.Get("hash"); hash != "" {
+			h, ok := parseID(hash)
+			if !ok {
+				w.WriteHeader(http.StatusBadRequest)
+				io.WriteString(w, string(utils.Json("Invalid hash")))
+				return
+			}
+			b = s.GetBlockchain().BlockByHash(h)
+		} else {
+			height, err := strconv.ParseUint(query.Get("height"), 10, 64)
+			if err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				io.WriteString(w, string(utils.Json("Missing hash or height")))
+				return
+			}
+			b = s.GetBlockchain().BlockByHeight(height)
+		}
+		if b == nil {
+			w.WriteHeader(http.StatusNotFound)
+			io.WriteString(w, string(utils.Json("Block not found")))
+			return
+		}
+		m, _ := b.MarshalJSON()
+		io.WriteString(w, string(m))
+	case http.MethodPost:
+		w.Header().Set("Content-Type", "application/json")
+		var b block.Block
+		if err := json.NewDecoder(req.Body).Decode(&b); err != nil {
+			log.Printf("Error decoding block: %s\n", err)
+			w.WriteHeader(http.StatusBadRequest)
+			io.WriteString(w, string(utils.Json("Error decoding block")))
+			return
+		}
+		err := s.GetBlockchain().AddBlock(&b)
+		switch {
+		case err == nil:
+			log.Printf("Accepted block %x from %s\n", b.Hash(), req.Header.Get(peer.PEER_HEADER))
+			w.WriteHeader(http.StatusCreated)
+			io.WriteString(w, string(utils.Json("Block accepted")))
+		case errors.Is(err, block.ErrKnownBlock):
+			io.WriteString(w, string(utils.Json("Block already known")))
+		case errors.Is(err, block.ErrBlockNotOnTip):
+			// we are behind or on a fork, see who has the heavier chain
+			go s.resolveConflicts()
+			w.WriteHeader(http.StatusConflict)
+			io.WriteString(w, string(utils.Json(err.Error())))
+		default:
+			log.Printf("Rejected block: %s\n", err)
+			w.WriteHeader(http.StatusBadRequest)
+			io.WriteString(w, string(utils.Json(fmt.Sprintf("Block rejected: %s", err))))
+		}
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		log.Printf("Method not allowed: %s", req.Method)
+	}
+}
+
+// replace our chain with the heaviest valid chain among the peers and
+// announce the new tip. every peer's headers are downloaded, so a round
+// that is running or just finished makes the call fail with
+// errResolveThrottled
+func (s *Server) resolveConflicts() (bool, error) {
+	s.resolveMux.Lock()
+	if s.resolving || time.Since(s.lastResolve) < RESOLVE_COOLDOWN {
+		s.resolveMux.Unlock()
+		return false, errResolveThrottled
+	}
+	s.resolving = true
+	s.resolveMux.Unlock()
+	defer func() {
+		s.resolveMux.Lock()
+		s.resolving = false
+		s.lastResolve = time.Now()
+		s.resolveMux.Unlock()
+	}()
+	fetchHeaders := func(p string) ([]*block.BlockHeader, error) {
+		headers := make([]*block.BlockHeader, 0)
+		for {
+			var res struct {
+				Headers []*block.BlockHeader `json:"headers"`
+			}
+			if err := s.peers.Get(p, fmt.Sprintf("/headers?from=%d&limit=%d", len(headers), MAX_HEADERS), &res); err != nil {
+				return nil, err
+			}
+			headers = append(headers, res.Headers...)
+			if len(res.Headers) < MAX_HEADERS {
+				return headers, nil
+			}
+		}
+	}
+	fetchBlocks := func(p string, from uint64) ([]*block.Block, error) {
+		blocks := make([]*block.Block, 0)
+		for {
+			var res struct {
+				Blocks []*block.Block `json:"blocks"`
+			}
+			path := fmt.Sprintf("/blocks?from=%d&limit=%d", from+uint64(len(blocks)), block.MAX_BLOCKS_PAGE)
+			if err := s.peers.Get(p, path, &res); err != nil {
+				return nil, err
+			}
+			blocks = append(blocks, res.Blocks...)
+			if len(res.Blocks) < block.MAX_BLOCKS_PAGE {
+				return blocks, nil
+			}
+		}
+	}
+	bc := s.GetBlockchain()
+	replaced, err := bc.ResolveConflicts(s.peers.List(), fetchHeaders, fetchBlocks)
+	if replaced {
+		// peers still on the old tip learn about the switch from its block
+		m, _ := bc.LastBlock().MarshalJSON()
+		s.peers.Broadcast("/block", m, "")
+	}
+	return replaced, err
+}
+
+func (s *Server) Consensus(w http.ResponseWriter, req *http.Request) {
+	switch req.Method {
+	case http.MethodGet:
+		w.Header().Set("Content-Type", "application/json")
+		replaced, err := s.resolveConflicts()
+		if errors.Is(err, errResolveThrottled) {
+			w.WriteHeader(http.StatusTooManyRequests)
+			io.WriteString(w, string(utils.Json(err.Error())))
+			return
+		}
+		if err != nil {
+			log.Printf("Error resolving conflicts: %s\n", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			io.WriteString(w, string(utils.Json(fmt.Sprintf("Consensus failed: %s", err))))
+			return
+		}
+		m, _ := json.Marshal(struct {
+			Replaced bool `json:"replaced"`
+		}{replaced})
+		io.WriteString(w, string(m))
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		log.Printf("Method not allowed: %s", req.Method)
+	}
+}
+
+func (s *Server) PeerList(w http.ResponseWriter, req *http.Request) {
+	switch req.Method {
+	case http.MethodGet:
+		w.Header().Set("Content-Type", "application/json")
+		m, _ := s.peers.MarshalJSON()
+		io.WriteString(w, string(m))
+	case http.MethodPost:
+		w.Header().Set("Content-Type", "application/json")
+		var p peer.PeerRequest
+		if err := json.NewDecoder(req.Body).Decode(&p); err != nil || !p.Validate() {
+			w.WriteHeader(http.StatusBadRequest)
+			io.WriteString(w, string(utils.Json("Missing peer url")))
+			return
+		}
+		added, err := s.peers.Connect(*p.URL, s.handshake)
+		if err != nil {
+			log.Printf("Error adding peer: %s\n", err)
+			w.WriteHeader(http.StatusBadGateway)
+			io.WriteString(w, string(utils.Json(err.Error())))
+			return
+		}
+		if !added {
+			io.WriteString(w, string(utils.Json("Peer not added")))
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+		io.WriteString(w, string(utils.Json("Peer added")))
+	case http.MethodDelete:
+		w.Header().Set("Content-Type", "application/json")
+		if !s.peers.Remove(req.URL.Query().Get("url")) {
+			w.WriteHeader(http.StatusNotFound)
+			io.WriteString(w, string(utils.Json("Unknown peer")))
+			return
+		}
+		io.WriteString(w, string(utils.Json("Peer removed")))
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		log.Printf("Method not allowed: %s", req.Method)
+	}
+}
+
+// a peer has to answer /headers and start from our genesis block before we
+// talk to it
+func (s *Server) handshake(p string) error {
+	var res struct {
+		Headers []*block.BlockHeader `json:"headers"`
+	}
+	if err := s.peers.Get(p, "/headers?from=0&limit=1", &res); err != nil {
+		return err
+	}
+	if len(res.Headers) != 1 || res.Headers[0].Hash() != block.GenesisBlock().Hash() {
+		return errors.New("peer does not share our genesis block")
+	}
+	return nil
+}
+
+func (s *Server) Headers(w http.ResponseWriter, req *http.Request) {
+	switch req.Method {
+	case http.MethodGet:
+		w.Header().Set("Content-Type", "application/json")
+		from, err := strconv.ParseUint(req.URL.Query().Get("from"), 10, 64)
+		if err != nil {
+			from = 0
+		}
+		limit, err := strconv.Atoi(req.URL.Query().Get("limit"))
+		if err != nil || limit <= 0 || limit > MAX_HEADERS {
+			limit = MAX_HEADERS
+		}
+		headers := s.GetBlockchain().Headers(from, limit)
+		m, _ := json.Marshal(struct {
+			Headers []*block.BlockHeader `json:"headers"`
+			Length  int                  `json:"length"`
+		}{
+			headers,
+			len(headers),
+		})
+		io.WriteString(w, string(m))
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		log.Printf("Method not allowed: %s", req.Method)
+	}
+}
+
+func (s *Server) TransactionProof(w http.ResponseWriter, req *http.Request) {
+	switch req.Method {
+	case http.MethodGet:
+		w.Header().Set("Content-Type", "application/json")
+		txID, ok := parseID(req.URL.Query().Get("id"))
+		if !ok {
+			w.WriteHeader(http.StatusBadRequest)
+			io.WriteString(w, string(utils.Json("Invalid transaction id")))
+			return
+		}
+		proof, err := s.GetBlockchain().TransactionProof(txID)
+		if err != nil {
+			w.WriteHeader(http.StatusNotFound)
+			io.WriteString(w, string(utils.Json(err.Error())))
+			return
+		}
+		m, _ := proof.MarshalJSON()
+		io.WriteString(w, string(m))
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		log.Printf("Method not allowed: %s", req.Method)
+	}
+}
+
+// transaction ids and block hashes are 64 hex characters
+func parseID(s string) ([32]byte, bool) {
+	var id [32]byte
+	b, err := hex.DecodeString(s)
+	if err != nil || len(b) != 32 {
+		return id, false
+	}
+	copy(id[:], b)
+	return id, true
+}
+
+// circulating and maximum supply and the current subsidy
+func (s *Server) Supply(w http.ResponseWriter, req *http.Request) {
+	switch req.Method {
+	case http.MethodGet:
+		w.Header().Set("Content-Type", "application/json")
+		m, _ := s.GetBlockchain().Supply().MarshalJSON()
+		io.WriteString(w, string(m))
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		log.Printf("Method not allowed: %s", req.Method)
+	}
+}
+
+// size and limits of the mempool
+func (s *Server) Mempool(w http.ResponseWriter, req *http.Request) {
+	switch req.Method {
+	case http.MethodGet:
+		w.Header().Set("Content-Type", "application/json")
+		m, _ := s.GetBlockchain().Mempool().MarshalJSON()
+		io.WriteString(w, string(m))
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		log.Printf("Method not allowed: %s", req.Method)
+	}
+}
+
+// look up or drop a pending transaction by id, dropping it also drops the
+// sender's later transactions that depend on it
+func (s *Server) MempoolTransaction(w http.ResponseWriter, req *http.Request) {
+	id, ok := parseID(req.URL.Query().Get("id"))
+	switch req.Method {
+	case http.MethodGet:
+		w.Header().Set("Content-Type", "application/json")
+		if !ok {
+			w.WriteHeader(http.StatusBadRequest)
+			io.WriteString(w, string(utils.Json("Invalid transaction id")))
+			return
+		}
+		t, found := s.GetBlockchain().Mempool().Get(id)
+		if !found {
+			w.WriteHeader(http.StatusNotFound)
+			io.WriteString(w, string(utils.Json("Transaction not pending")))
+			return
+		}
+		m, _ := t.MarshalJSON()
+		io.WriteString(w, string(m))
+	case http.MethodDelete:
+		w.Header().Set("Content-Type", "application/json")
+		if !ok {
+			w.WriteHeader(http.StatusBadRequest)
+			io.WriteString(w, string(utils.Json("Invalid transaction id")))
+			return
+		}
+		removed := s.GetBlockchain().RemoveTransaction(id)
+		if len(removed) == 0 {
+			w.WriteHeader(http.StatusNotFound)
+			io.WriteString(w, string(utils.Json("Transaction not pending")))
+			return
+		}
+		m, _ := json.Marshal(struct {
+			Removed []*block.Transaction `json:"removed"`
+		}{removed})
+		io.WriteString(w, string(m))
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		log.Printf("Method not allowed: %s", req.Method)
+	}
+}
+
+func (s *Server) AccountNonce(w http.ResponseWriter, req *http.Request) {
+	switch req.Method {
+	case http.MethodGet:
+		w.Header().Set("Content-Type", "application/json")
+		address := req.URL.Query().Get("address")
+		m, _ := json.Marshal(struct {
+			Nonce uint64 `json:"nonce"`
+		}{
+			Nonce: s.GetBlockchain().NextNonce(address),
+		})
+		io.WriteString(w, string(m))
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		log.Printf("Method not allowed: %s", req.Method)
+	}
+}
+
+func (s *Server) UTXOTransaction(w http.ResponseWriter, req *http.Request) {
+	switch req.Method {
+	case http.MethodPost:
+		var t block.Transaction
+		if err := json.NewDecoder(req.Body).Decode(&t); err != nil {
+			log.Printf("Error decoding transaction: %s\n", err)
+			w.WriteHeader(http.StatusBadRequest)
+			io.WriteString(w, string(utils.Json("Error decoding transaction")))
+			return
+		}
+		err := s.GetBlockchain().AddUTXOTransaction(&t)
+
+		w.Header().Set("Content-Type", "application/json")
+		var m []byte
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			m = utils.Json(fmt.Sprintf("Transaction not created: %s", err))
+		} else {
+			w.WriteHeader(http.StatusCreated)
+			m, _ = json.Marshal(struct {
+				Message string `json:"message"`
+				ID      string `json:"id"`
+			}{"Transaction created", fmt.Sprintf("%x", t.ID())})
+			relay, _ := t.MarshalJSON()
+			s.peers.Broadcast("/transaction/utxo", relay, req.Header.Get(peer.PEER_HEADER))
+		}
+		io.WriteString(w, string(m))
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		log.Printf("Method not allowed: %s", req.Method)
+	}
+}
+
+func (s *Server) UTXOs(w http.ResponseWriter, req *http.Request) {
+	switch req.Method {
+	case http.MethodGet:
+		w.Header().Set("Content-Type", "application/json")
+		address := req.URL.Query().Get("address")
+		unspent := s.GetBlockchain().UTXOs(address)
+		var total utils.Amount
+		for _, u := range unspent {
+			total += u.Output.Amount()
+		}
+		m, _ := json.Marshal(struct {
+			Outputs []*block.UnspentOutput `json:"outputs"`
+			Total   utils.Amount           `json:"total"`
+		}{unspent, total})
 		io.WriteString(w, string(m))
 	default:
 		w.WriteHeader(http.StatusMethodNotAllowed)
@@ -150,18 +874,86 @@ func (s *Server) AccountBalance(w http.ResponseWriter, req *http.Request) {
 }
 
 func (s *Server) Run() {
+	s.GetBlockchain()
+	// listen before announcing, peers call back to shake hands
+	ln, err := net.Listen("tcp", fmt.Sprintf(":%d", s.port))
+	if err != nil {
+		log.Fatal(err)
+	}
+	// write out the pending transactions before going down
+	go func() {
+		sig := make(chan os.Signal, 1)
+		signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+		<-sig
+		if err := s.GetBlockchain().Close(); err != nil {
+			log.Printf("Error closing blockchain: %s\n", err)
+		}
+		os.Exit(0)
+	}()
+	go func() {
+		s.peers.Announce()
+		// catch up with the network before doing anything else
+		if _, err := s.resolveConflicts(); err != nil {
+			log.Printf("Error syncing with peers: %s\n", err)
+		}
+	}()
 	http.HandleFunc("/", s.GetChain)
+	http.HandleFunc("/chain/validate", s.ValidateChain)
 	http.HandleFunc("/transaction", s.Transaction)
 	http.HandleFunc("/mine", s.Mine)
 	http.HandleFunc("/mine/start", s.StartMining)
+	http.HandleFunc("/mine/stop", s.StopMining)
+	http.HandleFunc("/mine/pause", s.PauseMining)
+	http.HandleFunc("/mine/status", s.MiningStatus)
 	http.HandleFunc("/account/balance", s.AccountBalance)
-	log.Fatal(http.ListenAndServe(fmt.Sprintf(":%d", s.port), nil))
+	http.HandleFunc("/fees/estimate", s.FeeEstimate)
+	http.HandleFunc("/mempool", s.Mempool)
+	http.HandleFunc("/supply", s.Supply)
+	http.HandleFunc("/mempool/transaction", s.MempoolTransaction)
+	http.HandleFunc("/account/nonce", s.AccountNonce)
+	http.HandleFunc("/account/transactions", s.AccountTransactions)
+	http.HandleFunc("/block", s.Block)
+	http.HandleFunc("/blocks", s.Blocks)
+	http.HandleFunc("/blocks/latest", s.LatestBlocks)
+	http.HandleFunc("/transaction/lookup", s.TransactionLookup)
+	http.HandleFunc("/chain/summary", s.ChainSummary)
+	http.HandleFunc("/explorer/", s.ExplorerIndex)
+	http.HandleFunc("/explorer/block", s.ExplorerBlock)
+	http.HandleFunc("/explorer/transaction", s.ExplorerTransaction)
+	http.HandleFunc("/explorer/address", s.ExplorerAddress)
+	http.HandleFunc("/explorer/mempool", s.ExplorerMempool)
+	http.HandleFunc("/explorer/search", s.ExplorerSearch)
+	http.HandleFunc("/peers", s.PeerList)
+	http.HandleFunc("/consensus", s.Consensus)
+	http.HandleFunc("/headers", s.Headers)
+	http.HandleFunc("/transaction/proof", s.TransactionProof)
+	http.HandleFunc("/transaction/utxo", s.UTXOTransaction)
+	http.HandleFunc("/utxos", s.UTXOs)
+	log.Fatal(http.Serve(ln, nil))
 	log.Print("Server started")
 }
 
 func main() {
 	port := flag.Uint("port", 5000, "TCP port to listen on")
+	dataDir := flag.String("data", "", "Directory to persist the blockchain in (in memory if empty)")
+	advertise := flag.String("advertise", "", "URL other nodes reach this node at (default http://localhost:<port>)")
+	seeds := flag.String("peers", "", "Comma separated list of peers to connect to")
+	workers := flag.Int("workers", 0, "Goroutines searching for proof of work (default one per CPU)")
+	interval := flag.Duration("interval", 0, "Pause between blocks mined in the background (default none, the difficulty sets the pace)")
+	reward := flag.String("reward", "", "Address mining rewards are paid to (default a wallet kept in the data directory, or one generated in memory without -data)")
 	flag.Parse()
-	app := NewServer(uint16(*port))
+	if *reward != "" && !utils.ValidAddress(*reward) {
+		log.Fatalf("Invalid reward address %q\n", *reward)
+	}
+	if *advertise == "" {
+		*advertise = fmt.Sprintf("http://localhost:%d", *port)
+	}
+	app := NewServer(uint16(*port), *dataDir, *advertise, *reward, block.Config{
+		MiningWorkers:  *workers,
+		MiningInterval: *interval,
+	})
+	for _, p := range strings.Split(*seeds, ",") {
+		app.Peers().Add(p)
+	}
 	app.Run()
 }
@@ -0,0 +1,200 @@
+package light
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"sync"
+
+	"github.com/nazeemnato/stonkcoin/block"
+)
+
+const (
+	// headers requested per round trip while syncing
+	SYNC_BATCH = 2000
+	// most bytes read from an answer of the gateway, like peer.MAX_RESPONSE_SIZE
+	MAX_RESPONSE_SIZE = 32 << 20
+)
+
+// simplified payment verification client
+//
+// it only keeps block headers, checks their proof of work and linkage and
+// verifies merkle proofs that a transaction is in one of them
+type Client struct {
+	gateway string
+	headers []*block.BlockHeader
+	http    *http.Client
+	mux     sync.Mutex
+}
+
+// create new light client talking to the node at gateway, starting from the
+// genesis header
+func NewClient(gateway string) *Client {
+	return &Client{
+		gateway: gateway,
+		headers: []*block.BlockHeader{block.GenesisBlock().Header()},
+		http:    &http.Client{},
+	}
+}
+
+// height of the best header we know
+func (c *Client) Height() uint64 {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	return uint64(len(c.headers) - 1)
+}
+
+// header at height, nil if we don't have it
+func (c *Client) Header(height uint64) *block.BlockHeader {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	if height >= uint64(len(c.headers)) {
+		return nil
+	}
+	return c.headers[height]
+}
+
+// append headers that extend our best header
+func (c *Client) AddHeaders(headers []*block.BlockHeader) error {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	chain, err := extendHeaders(c.headers, headers)
+	if err != nil {
+		return err
+	}
+	c.headers = chain
+	return nil
+}
+
+// validate headers on top of chain and return the longer chain
+func extendHeaders(chain []*block.BlockHeader, headers []*block.BlockHeader) ([]*block.BlockHeader, error) {
+	extended := make([]*block.BlockHeader, len(chain), len(chain)+len(headers))
+	copy(extended, chain)
+	for _, h := range headers {
+		prev := extended[len(extended)-1]
+		if err := block.ValidateHeader(prev, h, block.NextHeaderDifficulty(extended)); err != nil {
+			return nil, err
+		}
+		extended = append(extended, h)
+	}
+	return extended, nil
+}
+
+// fetch the headers we are missing from the gateway. when the gateway is on
+// a different branch the whole header chain is fetched again and kept if it
+// carries more work
+func (c *Client) Sync() error {
+	from := c.Height() + 1
+	headers, err := c.fetchHeaders(from)
+	if err != nil {
+		return err
+	}
+	if len(headers) == 0 {
+		return nil
+	}
+	if err := c.AddHeaders(headers); err == nil {
+		return c.syncFrom(from + uint64(len(headers)))
+	}
+	log.Printf("Headers from %s don't extend ours, resyncing\n", c.gateway)
+	chain := []*block.BlockHeader{block.GenesisBlock().Header()}
+	for {
+		headers, err := c.fetchHeaders(uint64(len(chain)))
+		if err != nil {
+			return err
+		}
+		if len(headers) == 0 {
+			break
+		}
+		if chain, err = extendHeaders(chain, headers); err != nil {
+			return err
+		}
+	}
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	if block.HeadersWork(chain).Cmp(block.HeadersWork(c.headers)) <= 0 {
+		return fmt.Errorf("chain of %s is not heavier than ours", c.gateway)
+	}
+	c.headers = chain
+	return nil
+}
+
+// keep fetching until the gateway has nothing new
+func (c *Client) syncFrom(from uint64) error {
+	for {
+		headers, err := c.fetchHeaders(from)
+		if err != nil {
+			return err
+		}
+		if len(headers) == 0 {
+			return nil
+		}
+		if err := c.AddHeaders(headers); err != nil {
+			return err
+		}
+		from += uint64(len(headers))
+	}
+}
+
+func (c *Client) fetchHeaders(from uint64) ([]*block.BlockHeader, error) {
+	endpoint := fmt.Sprintf("%s/headers?from=%d&limit=%d", c.gateway, from, SYNC_BATCH)
+	var v struct {
+		Headers []*block.BlockHeader `json:"headers"`
+	}
+	if err := c.get(endpoint, &v); err != nil {
+		return nil, err
+	}
+	return v.Headers, nil
+}
+
+// ask the gateway for the inclusion proof of a transaction and check it
+// against our headers, returns the number of confirmations
+func (c *Client) VerifyTransaction(id string) (uint64, error) {
+	if _, err := hex.DecodeString(id); err != nil || len(id) != 64 {
+		return 0, fmt.Errorf("invalid transaction id %q", id)
+	}
+	var proof block.TransactionProof
+	endpoint := fmt.Sprintf("%s/transaction/proof?id=%s", c.gateway, url.QueryEscape(id))
+	if err := c.get(endpoint, &proof); err != nil {
+		return 0, err
+	}
+	if fmt.Sprintf("%x", proof.Transaction().ID()) != id {
+		return 0, fmt.Errorf("gateway proved a different transaction")
+	}
+	return c.VerifyProof(&proof)
+}
+
+// check an inclusion proof against our headers, returns the number of
+// confirmations
+func (c *Client) VerifyProof(proof *block.TransactionProof) (uint64, error) {
+	header := c.Header(proof.Height())
+	if header == nil {
+		return 0, fmt.Errorf("no header at height %d, sync first", proof.Height())
+	}
+	if err := proof.Verify(header); err != nil {
+		return 0, err
+	}
+	return c.Height() - proof.Height() + 1, nil
+}
+
+func (c *Client) get(endpoint string, v interface{}) error {
+	res, err := c.http.Get(endpoint)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s answered %s", c.gateway, res.Status)
+	}
+	body, err := io.ReadAll(io.LimitReader(res.Body, MAX_RESPONSE_SIZE+1))
+	if err != nil {
+		return err
+	}
+	if len(body) > MAX_RESPONSE_SIZE {
+		return fmt.Errorf("%s answered more than %d bytes", c.gateway, MAX_RESPONSE_SIZE)
+	}
+	return json.Unmarshal(body, v)
+}
@@ -0,0 +1,113 @@
+package light
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/nazeemnato/stonkcoin/block"
+	"github.com/nazeemnato/stonkcoin/wallet"
+)
+
+// gateway serving /headers and /transaction/proof the way chain_server does,
+// tamper rewrites every proof before it is sent
+func testGateway(t *testing.T, bc *block.Blockchain, tamper func(proof map[string]interface{})) *httptest.Server {
+	t.Helper()
+	mux := http.NewServeMux()
+	mux.HandleFunc("/headers", func(w http.ResponseWriter, req *http.Request) {
+		from, _ := strconv.ParseUint(req.URL.Query().Get("from"), 10, 64)
+		limit, _ := strconv.Atoi(req.URL.Query().Get("limit"))
+		headers := bc.Headers(from, limit)
+		json.NewEncoder(w).Encode(struct {
+			Headers []*block.BlockHeader `json:"headers"`
+			Length  int                  `json:"length"`
+		}{headers, len(headers)})
+	})
+	mux.HandleFunc("/transaction/proof", func(w http.ResponseWriter, req *http.Request) {
+		var id [32]byte
+		hex.Decode(id[:], []byte(req.URL.Query().Get("id")))
+		proof, err := bc.TransactionProof(id)
+		if err != nil {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		m, _ := proof.MarshalJSON()
+		var v map[string]interface{}
+		json.Unmarshal(m, &v)
+		tamper(v)
+		json.NewEncoder(w).Encode(v)
+	})
+	return httptest.NewServer(mux)
+}
+
+func TestVerifyTransaction(t *testing.T) {
+	bc, err := block.NewBlockchainWithConfig(wallet.NewWallet().Address(), 0, block.Config{MiningWorkers: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer bc.Close()
+	for i := 0; i < 3; i++ {
+		bc.Mining()
+	}
+	id := fmt.Sprintf("%x", bc.BlockByHeight(2).Transactions()[0].ID())
+	tests := []struct {
+		name   string
+		tamper func(proof map[string]interface{})
+		ok     bool
+	}{
+		{"valid", func(proof map[string]interface{}) {}, true},
+		{"amount", func(proof map[string]interface{}) {
+			proof["transaction"].(map[string]interface{})["amount"] = "1000000"
+		}, false},
+		{"other block", func(proof map[string]interface{}) {
+			proof["height"] = 1
+		}, false},
+		{"leaf", func(proof map[string]interface{}) {
+			proof["proof"].(map[string]interface{})["leaf"] = fmt.Sprintf("%x", [32]byte{1})
+		}, false},
+	}
+	for _, tt := range tests {
+		gateway := testGateway(t, bc, tt.tamper)
+		c := NewClient(gateway.URL)
+		if err := c.Sync(); err != nil {
+			t.Fatalf("%s: %s", tt.name, err)
+		}
+		if c.Height() != 3 {
+			t.Fatalf("%s: synced to height %d, want 3", tt.name, c.Height())
+		}
+		confirmations, err := c.VerifyTransaction(id)
+		gateway.Close()
+		if !tt.ok {
+			if err == nil {
+				t.Errorf("%s: tampered proof was accepted", tt.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %s", tt.name, err)
+			continue
+		}
+		if confirmations != 2 {
+			t.Errorf("%s: %d confirmations, want 2", tt.name, confirmations)
+		}
+	}
+}
+
+// the answer is cut off at MAX_RESPONSE_SIZE, a gateway sending more is an
+// error even when the json would parse
+func TestResponseSizeLimit(t *testing.T) {
+	gateway := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		io.WriteString(w, strings.Repeat(" ", MAX_RESPONSE_SIZE))
+		io.WriteString(w, `{"headers": [], "length": 0}`)
+	}))
+	defer gateway.Close()
+	if err := NewClient(gateway.URL).Sync(); err == nil || !strings.Contains(err.Error(), "more than") {
+		t.Errorf("oversized answer gave %v, want the size error", err)
+	}
+}
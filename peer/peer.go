@@ -0,0 +1,199 @@
+package peer
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// set on every request a node makes to its peers, carries the url of the
+	// sending node so it isn't gossiped straight back
+	PEER_HEADER  = "X-Stonk-Peer"
+	PEER_TIMEOUT = 5 * time.Second
+	// most bytes read from a peer's answer, a hostile peer can't make us
+	// buffer more than this
+	MAX_RESPONSE_SIZE = 32 << 20
+)
+
+// the set of chain_server nodes this node talks to, identified by base url
+type Peers struct {
+	self   string
+	peers  map[string]bool
+	client *http.Client
+	mux    sync.Mutex
+}
+
+type PeerRequest struct {
+	URL *string `json:"url"`
+}
+
+func (pr *PeerRequest) Validate() bool {
+	return pr.URL != nil
+}
+
+// create new peer set for the node reachable at self (e.g. http://localhost:5000)
+func NewPeers(self string) *Peers {
+	return &Peers{
+		self:   Normalize(self),
+		peers:  make(map[string]bool),
+		client: &http.Client{Timeout: PEER_TIMEOUT},
+	}
+}
+
+// turn host:port or a url with trailing slashes into http://host:port
+func Normalize(peer string) string {
+	peer = strings.TrimSpace(peer)
+	if peer == "" {
+		return ""
+	}
+	if !strings.Contains(peer, "://") {
+		peer = "http://" + peer
+	}
+	return strings.TrimRight(peer, "/")
+}
+
+func (p *Peers) Self() string {
+	return p.self
+}
+
+// add a peer, false if it is invalid, ourselves or already known. meant for
+// peers the operator trusts, everyone else goes through Connect
+func (p *Peers) Add(peer string) bool {
+	peer = Normalize(peer)
+	if !p.valid(peer) {
+		return false
+	}
+	p.mux.Lock()
+	defer p.mux.Unlock()
+	if p.peers[peer] {
+		return false
+	}
+	p.peers[peer] = true
+	log.Printf("Added peer %s\n", peer)
+	return true
+}
+
+// add a peer once handshake accepts it, so a url nobody answers at or a node
+// on another chain is never gossiped to or synced from. false if it is
+// invalid, ourselves or already known
+func (p *Peers) Connect(peer string, handshake func(peer string) error) (bool, error) {
+	peer = Normalize(peer)
+	if !p.valid(peer) || p.Known(peer) {
+		return false, nil
+	}
+	if err := handshake(peer); err != nil {
+		return false, fmt.Errorf("handshake with %s failed: %w", peer, err)
+	}
+	return p.Add(peer), nil
+}
+
+func (p *Peers) valid(peer string) bool {
+	if peer == "" || peer == p.self {
+		return false
+	}
+	u, err := url.Parse(peer)
+	return err == nil && u.Host != ""
+}
+
+func (p *Peers) Known(peer string) bool {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+	return p.peers[Normalize(peer)]
+}
+
+// remove a peer, false if it wasn't known
+func (p *Peers) Remove(peer string) bool {
+	peer = Normalize(peer)
+	p.mux.Lock()
+	defer p.mux.Unlock()
+	if !p.peers[peer] {
+		return false
+	}
+	delete(p.peers, peer)
+	log.Printf("Removed peer %s\n", peer)
+	return true
+}
+
+// sorted list of known peers
+func (p *Peers) List() []string {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+	peers := make([]string, 0, len(p.peers))
+	for peer := range p.peers {
+		peers = append(peers, peer)
+	}
+	sort.Strings(peers)
+	return peers
+}
+
+// post body to path on every peer except the one it came from, without
+// waiting for the answers
+func (p *Peers) Broadcast(path string, body []byte, except string) {
+	except = Normalize(except)
+	for _, peer := range p.List() {
+		if peer == except {
+			continue
+		}
+		go func(peer string) {
+			res, err := p.post(peer+path, body)
+			if err != nil {
+				log.Printf("Error sending %s to %s: %s\n", path, peer, err)
+				return
+			}
+			res.Body.Close()
+		}(peer)
+	}
+}
+
+// tell every peer about this node so they gossip back to us
+func (p *Peers) Announce() {
+	m, _ := json.Marshal(PeerRequest{&p.self})
+	p.Broadcast("/peers", m, "")
+}
+
+// fetch path from a peer and decode the json answer into v
+func (p *Peers) Get(peer string, path string, v interface{}) error {
+	req, err := http.NewRequest(http.MethodGet, Normalize(peer)+path, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set(PEER_HEADER, p.self)
+	res, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s answered %s", peer, res.Status)
+	}
+	return json.NewDecoder(io.LimitReader(res.Body, MAX_RESPONSE_SIZE)).Decode(v)
+}
+
+func (p *Peers) post(endpoint string, body []byte) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(PEER_HEADER, p.self)
+	return p.client.Do(req)
+}
+
+func (p *Peers) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Self  string   `json:"self"`
+		Peers []string `json:"peers"`
+	}{
+		Self:  p.self,
+		Peers: p.List(),
+	})
+}
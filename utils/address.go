@@ -0,0 +1,56 @@
+package utils
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/sha256"
+
+	"github.com/btcsuite/btcutil/base58"
+	"golang.org/x/crypto/ripemd160"
+)
+
+// derive the base58 address of a public key, the chain and the wallet must
+// agree on this or signatures can't be tied to senders
+func AddressFromPublicKey(publicKey *ecdsa.PublicKey) string {
+	// perform sha256 on public key
+	h2 := sha256.New()
+	h2.Write(publicKey.X.Bytes())
+	h2.Write(publicKey.Y.Bytes())
+	digest2 := h2.Sum(nil)
+	// perform ripemd160 on sha256
+	h3 := ripemd160.New()
+	h3.Write(digest2)
+	digest3 := h3.Sum(nil)
+	// add version byte (0x00)
+	vd4 := make([]byte, 21)
+	vd4[0] = 0x00
+	copy(vd4[1:], digest3)
+	// perform sha256 on extended version byte
+	h5 := sha256.New()
+	h5.Write(vd4)
+	digest5 := h5.Sum(nil)
+	// perform sha256 on sha256
+	h6 := sha256.New()
+	h6.Write(digest5)
+	digest6 := h6.Sum(nil)
+	// take first 4 bytes of sha256 for checksum
+	checksum := digest6[:4]
+	// add checksum to extended version byte from above
+	dc8 := make([]byte, 25)
+	copy(dc8[:21], vd4[:])
+	copy(dc8[21:], checksum[:])
+	// base58 encode
+	return base58.Encode(dc8)
+}
+
+// check that address is base58 with the version byte and checksum
+// AddressFromPublicKey produces
+func ValidAddress(address string) bool {
+	decoded := base58.Decode(address)
+	if len(decoded) != 25 || decoded[0] != 0x00 {
+		return false
+	}
+	digest := sha256.Sum256(decoded[:21])
+	digest = sha256.Sum256(digest[:])
+	return bytes.Equal(digest[:4], decoded[21:])
+}
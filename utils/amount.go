@@ -0,0 +1,125 @@
+package utils
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// amounts are counted in integer base units, AMOUNT_DECIMALS digits after
+// the decimal point make up one coin
+type Amount int64
+
+const (
+	AMOUNT_DECIMALS        = 8
+	COIN            Amount = 100000000
+	MAX_AMOUNT      Amount = math.MaxInt64
+)
+
+var (
+	ErrInvalidAmount  = errors.New("invalid amount")
+	ErrNegativeAmount = errors.New("amount must not be negative")
+	ErrAmountOverflow = errors.New("amount is too large")
+)
+
+// parse a decimal string such as "12", "0.5" or "1.00000001"
+//
+// only plain digits with an optional decimal point are accepted, so signs,
+// exponents, NaN and Inf are all rejected
+func ParseAmount(s string) (Amount, error) {
+	s = strings.TrimSpace(s)
+	if strings.HasPrefix(s, "-") {
+		return 0, ErrNegativeAmount
+	}
+	whole, frac := s, ""
+	if i := strings.IndexByte(s, '.'); i >= 0 {
+		whole, frac = s[:i], s[i+1:]
+	}
+	if whole == "" && frac == "" {
+		return 0, fmt.Errorf("%w: %q", ErrInvalidAmount, s)
+	}
+	if !isDigits(whole) || !isDigits(frac) {
+		return 0, fmt.Errorf("%w: %q", ErrInvalidAmount, s)
+	}
+	if len(frac) > AMOUNT_DECIMALS {
+		return 0, fmt.Errorf("%w: more than %d decimals", ErrInvalidAmount, AMOUNT_DECIMALS)
+	}
+	if whole == "" {
+		whole = "0"
+	}
+	frac += strings.Repeat("0", AMOUNT_DECIMALS-len(frac))
+	w, err := strconv.ParseUint(whole, 10, 64)
+	if err != nil {
+		return 0, ErrAmountOverflow
+	}
+	f, _ := strconv.ParseUint(frac, 10, 64)
+	if w > (uint64(MAX_AMOUNT)-f)/uint64(COIN) {
+		return 0, ErrAmountOverflow
+	}
+	return Amount(w*uint64(COIN) + f), nil
+}
+
+func isDigits(s string) bool {
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// add two amounts, failing instead of wrapping around
+func (a Amount) Add(b Amount) (Amount, error) {
+	if b > 0 && a > MAX_AMOUNT-b {
+		return 0, ErrAmountOverflow
+	}
+	if b < 0 && a < math.MinInt64-b {
+		return 0, ErrAmountOverflow
+	}
+	return a + b, nil
+}
+
+// canonical decimal form, trailing zeros are dropped ("1.5", "10")
+func (a Amount) String() string {
+	sign := ""
+	u := uint64(a)
+	if a < 0 {
+		sign = "-"
+		u = uint64(-(a + 1)) + 1
+	}
+	whole := u / uint64(COIN)
+	frac := u % uint64(COIN)
+	if frac == 0 {
+		return fmt.Sprintf("%s%d", sign, whole)
+	}
+	fs := strings.TrimRight(fmt.Sprintf("%0*d", AMOUNT_DECIMALS, frac), "0")
+	return fmt.Sprintf("%s%d.%s", sign, whole, fs)
+}
+
+// amounts travel as decimal strings so no client ever rounds them through a
+// float
+func (a Amount) MarshalJSON() ([]byte, error) {
+	return json.Marshal(a.String())
+}
+
+// accepts both "1.5" and 1.5, null leaves the amount as it is
+func (a *Amount) UnmarshalJSON(data []byte) error {
+	s := string(data)
+	if s == "null" {
+		return nil
+	}
+	if strings.HasPrefix(s, `"`) {
+		if err := json.Unmarshal(data, &s); err != nil {
+			return err
+		}
+	}
+	v, err := ParseAmount(s)
+	if err != nil {
+		return err
+	}
+	*a = v
+	return nil
+}
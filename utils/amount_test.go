@@ -0,0 +1,125 @@
+package utils
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+func TestParseAmount(t *testing.T) {
+	tests := []struct {
+		in   string
+		want Amount
+		err  error
+	}{
+		{"0", 0, nil},
+		{"12", 12 * COIN, nil},
+		{"0.5", COIN / 2, nil},
+		{".5", COIN / 2, nil},
+		{"5.", 5 * COIN, nil},
+		{" 1.5 ", COIN + COIN/2, nil},
+		{"1.00000001", COIN + 1, nil},
+		{"0.00000001", 1, nil},
+		{"92233720368.54775807", MAX_AMOUNT, nil},
+		{"92233720368.54775808", 0, ErrAmountOverflow},
+		{"99999999999999999999", 0, ErrAmountOverflow},
+		{"1.000000001", 0, ErrInvalidAmount},
+		{"-1", 0, ErrNegativeAmount},
+		{"+1", 0, ErrInvalidAmount},
+		{"1e8", 0, ErrInvalidAmount},
+		{"1,5", 0, ErrInvalidAmount},
+		{"1.2.3", 0, ErrInvalidAmount},
+		{".", 0, ErrInvalidAmount},
+		{"", 0, ErrInvalidAmount},
+	}
+	for _, tt := range tests {
+		got, err := ParseAmount(tt.in)
+		if !errors.Is(err, tt.err) {
+			t.Errorf("ParseAmount(%q) error = %v, want %v", tt.in, err, tt.err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseAmount(%q) = %d, want %d", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestAmountString(t *testing.T) {
+	tests := []struct {
+		in   Amount
+		want string
+	}{
+		{0, "0"},
+		{1, "0.00000001"},
+		{COIN, "1"},
+		{10 * COIN, "10"},
+		{COIN + COIN/2, "1.5"},
+		{COIN/10 + 1, "0.10000001"},
+		{-COIN / 2, "-0.5"},
+		{MAX_AMOUNT, "92233720368.54775807"},
+		{-MAX_AMOUNT - 1, "-92233720368.54775808"},
+	}
+	for _, tt := range tests {
+		if got := tt.in.String(); got != tt.want {
+			t.Errorf("Amount(%d).String() = %q, want %q", int64(tt.in), got, tt.want)
+		}
+		if tt.in < 0 {
+			continue
+		}
+		// the canonical form parses back to the same amount
+		if back, err := ParseAmount(tt.want); err != nil || back != tt.in {
+			t.Errorf("ParseAmount(%q) = %d, %v, want %d", tt.want, back, err, tt.in)
+		}
+	}
+}
+
+func TestAmountJSON(t *testing.T) {
+	m, err := json.Marshal(COIN + COIN/4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(m) != `"1.25"` {
+		t.Errorf("marshalled %s, want \"1.25\"", m)
+	}
+	tests := []struct {
+		in   string
+		want Amount
+	}{
+		{`"1.25"`, COIN + COIN/4},
+		{`1.25`, COIN + COIN/4},
+		{`"0"`, 0},
+	}
+	for _, tt := range tests {
+		var a Amount
+		if err := json.Unmarshal([]byte(tt.in), &a); err != nil {
+			t.Errorf("Unmarshal(%s): %s", tt.in, err)
+			continue
+		}
+		if a != tt.want {
+			t.Errorf("Unmarshal(%s) = %d, want %d", tt.in, a, tt.want)
+		}
+	}
+	var a Amount
+	if err := json.Unmarshal([]byte(`"-1"`), &a); err == nil {
+		t.Error("negative amount was accepted")
+	}
+	v := struct {
+		Amount Amount  `json:"amount"`
+		Fee    *Amount `json:"fee"`
+	}{Amount: COIN}
+	if err := json.Unmarshal([]byte(`{"amount":null,"fee":null}`), &v); err != nil {
+		t.Fatalf("null amounts: %s", err)
+	}
+	if v.Amount != COIN || v.Fee != nil {
+		t.Errorf("null changed the amounts to %d and %v", v.Amount, v.Fee)
+	}
+}
+
+func TestAmountAdd(t *testing.T) {
+	if _, err := MAX_AMOUNT.Add(1); !errors.Is(err, ErrAmountOverflow) {
+		t.Errorf("MAX_AMOUNT + 1 error = %v, want overflow", err)
+	}
+	if got, err := COIN.Add(COIN); err != nil || got != 2*COIN {
+		t.Errorf("COIN + COIN = %d, %v", got, err)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"crypto/ecdsa"
 	"crypto/elliptic"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"math/big"
 )
@@ -56,3 +57,64 @@ func SignatureFromString(s string) *Signature {
 		S: &y,
 	}
 }
+
+// public key as the 128 hex characters of x and y
+func PublicKeyString(publicKey *ecdsa.PublicKey) string {
+	return fmt.Sprintf("%064x%064x", publicKey.X.Bytes(), publicKey.Y.Bytes())
+}
+
+// like PublicKeyFromString but rejects malformed input and points that are
+// not on the curve
+func ParsePublicKey(s string) (*ecdsa.PublicKey, error) {
+	if len(s) != 128 {
+		return nil, errors.New("public key must be 128 hex characters")
+	}
+	if _, err := hex.DecodeString(s); err != nil {
+		return nil, errors.New("public key is not hex encoded")
+	}
+	publicKey := PublicKeyFromString(s)
+	if !publicKey.Curve.IsOnCurve(publicKey.X, publicKey.Y) {
+		return nil, errors.New("public key is not on the P-256 curve")
+	}
+	return publicKey, nil
+}
+
+// like SignatureFromString but rejects malformed input
+func ParseSignature(s string) (*Signature, error) {
+	if len(s) != 128 {
+		return nil, errors.New("signature must be 128 hex characters")
+	}
+	if _, err := hex.DecodeString(s); err != nil {
+		return nil, errors.New("signature is not hex encoded")
+	}
+	return SignatureFromString(s), nil
+}
+
+// P-256 private key for the scalar d. the public key is always computed from
+// d, so a key can't claim someone else's address
+func PrivateKeyFromScalar(d *big.Int) (*ecdsa.PrivateKey, error) {
+	curve := elliptic.P256()
+	if d == nil || d.Sign() <= 0 || d.Cmp(curve.Params().N) >= 0 {
+		return nil, errors.New("private key is out of range")
+	}
+	privateKey := &ecdsa.PrivateKey{D: new(big.Int).Set(d)}
+	privateKey.Curve = curve
+	privateKey.X, privateKey.Y = curve.ScalarBaseMult(d.FillBytes(make([]byte, 32)))
+	return privateKey, nil
+}
+
+// like PrivateKeyFromString but derives the public key and rejects malformed
+// input. up to 64 hex characters, leading zeros may be left out
+func ParsePrivateKey(s string) (*ecdsa.PrivateKey, error) {
+	if len(s) == 0 || len(s) > 64 {
+		return nil, errors.New("private key must be up to 64 hex characters")
+	}
+	if len(s)%2 == 1 {
+		s = "0" + s
+	}
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		return nil, errors.New("private key is not hex encoded")
+	}
+	return PrivateKeyFromScalar(new(big.Int).SetBytes(b))
+}
@@ -0,0 +1,63 @@
+package wallet
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+)
+
+// talks to a chain_server node on behalf of a wallet
+type Client struct {
+	gateway string
+	http    *http.Client
+}
+
+// create new client for the node at gateway (e.g. http://localhost:5000)
+func NewClient(gateway string) *Client {
+	return &Client{gateway, &http.Client{}}
+}
+
+func (c *Client) Gateway() string {
+	return c.gateway
+}
+
+// ask the node for the nonce the address has to use in its next transaction
+func (c *Client) NextNonce(address string) (uint64, error) {
+	endpoint := fmt.Sprintf("%s/account/nonce?address=%s", c.gateway, url.QueryEscape(address))
+	res, err := c.http.Get(endpoint)
+	if err != nil {
+		return 0, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("nonce request failed: %s", res.Status)
+	}
+	var v struct {
+		Nonce uint64 `json:"nonce"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&v); err != nil {
+		return 0, err
+	}
+	return v.Nonce, nil
+}
+
+// hand a signed transfer to the node
+func (c *Client) SendTransaction(t *SignedTransaction) error {
+	m, err := json.Marshal(t)
+	if err != nil {
+		return err
+	}
+	res, err := c.http.Post(c.gateway+"/transaction", "application/json", bytes.NewReader(m))
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusCreated {
+		body, _ := io.ReadAll(res.Body)
+		return fmt.Errorf("transaction rejected: %s %s", res.Status, bytes.TrimSpace(body))
+	}
+	return nil
+}
@@ -0,0 +1,287 @@
+package wallet
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/nazeemnato/stonkcoin/utils"
+	"golang.org/x/crypto/scrypt"
+)
+
+const (
+	KEYSTORE_VERSION = 1
+	// scrypt cost, about 100ms and 32MB per unlock
+	SCRYPT_N = 1 << 15
+	SCRYPT_R = 8
+	SCRYPT_P = 1
+	// limits on the cost a key file may ask for, so opening a crafted file
+	// can't take minutes or gigabytes
+	MAX_SCRYPT_N      = 1 << 18
+	MAX_SCRYPT_R      = 16
+	MAX_SCRYPT_P      = 4
+	MAX_SCRYPT_MEMORY = 256 << 20
+)
+
+var (
+	ErrWrongPassphrase = errors.New("wrong passphrase or corrupted key")
+	ErrUnknownWallet   = errors.New("no wallet stored for this address")
+	ErrWalletLocked    = errors.New("wallet is locked")
+)
+
+// private key sealed with a passphrase. the key is derived with scrypt and
+// the private key encrypted with AES-256-GCM, the address is authenticated
+// along with it so a key file can't be passed off as another address
+type EncryptedKey struct {
+	Version   int    `json:"version"`
+	Address   string `json:"address"`
+	PublicKey string `json:"publicKey"`
+	Crypto    struct {
+		KDF       string `json:"kdf"`
+		KDFParams struct {
+			N    int    `json:"n"`
+			R    int    `json:"r"`
+			P    int    `json:"p"`
+			Salt string `json:"salt"`
+		} `json:"kdfparams"`
+		Cipher     string `json:"cipher"`
+		Nonce      string `json:"nonce"`
+		Ciphertext string `json:"ciphertext"`
+	} `json:"crypto"`
+}
+
+func aead(passphrase string, salt []byte, n, r, p int) (cipher.AEAD, error) {
+	key, err := scrypt.Key([]byte(passphrase), salt, n, r, p, 32)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// seal the wallet's private key with passphrase
+func Encrypt(w *Wallet, passphrase string) (*EncryptedKey, error) {
+	salt := make([]byte, 32)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	gcm, err := aead(passphrase, salt, SCRYPT_N, SCRYPT_R, SCRYPT_P)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	k := &EncryptedKey{Version: KEYSTORE_VERSION, Address: w.address, PublicKey: w.PublicKeyStr()}
+	k.Crypto.KDF = "scrypt"
+	k.Crypto.KDFParams.N = SCRYPT_N
+	k.Crypto.KDFParams.R = SCRYPT_R
+	k.Crypto.KDFParams.P = SCRYPT_P
+	k.Crypto.KDFParams.Salt = hex.EncodeToString(salt)
+	k.Crypto.Cipher = "aes-256-gcm"
+	k.Crypto.Nonce = hex.EncodeToString(nonce)
+	k.Crypto.Ciphertext = hex.EncodeToString(gcm.Seal(nil, nonce, w.privateKey.D.FillBytes(make([]byte, 32)), []byte(w.address)))
+	return k, nil
+}
+
+// open the key with passphrase and rebuild the wallet
+func Decrypt(k *EncryptedKey, passphrase string) (*Wallet, error) {
+	if k.Version != KEYSTORE_VERSION || k.Crypto.KDF != "scrypt" || k.Crypto.Cipher != "aes-256-gcm" {
+		return nil, fmt.Errorf("unsupported key version %d (%s, %s)", k.Version, k.Crypto.KDF, k.Crypto.Cipher)
+	}
+	salt, err := hex.DecodeString(k.Crypto.KDFParams.Salt)
+	if err != nil {
+		return nil, fmt.Errorf("invalid salt: %w", err)
+	}
+	nonce, err := hex.DecodeString(k.Crypto.Nonce)
+	if err != nil {
+		return nil, fmt.Errorf("invalid nonce: %w", err)
+	}
+	ciphertext, err := hex.DecodeString(k.Crypto.Ciphertext)
+	if err != nil {
+		return nil, fmt.Errorf("invalid ciphertext: %w", err)
+	}
+	params := k.Crypto.KDFParams
+	if err := checkScryptParams(params.N, params.R, params.P, len(salt)); err != nil {
+		return nil, err
+	}
+	gcm, err := aead(passphrase, salt, params.N, params.R, params.P)
+	if err != nil {
+		return nil, err
+	}
+	if len(nonce) != gcm.NonceSize() {
+		return nil, fmt.Errorf("invalid nonce length %d", len(nonce))
+	}
+	d, err := gcm.Open(nil, nonce, ciphertext, []byte(k.Address))
+	if err != nil {
+		return nil, ErrWrongPassphrase
+	}
+	privateKey, err := utils.PrivateKeyFromScalar(new(big.Int).SetBytes(d))
+	if err != nil {
+		return nil, err
+	}
+	w := walletFromKey(privateKey)
+	if w.address != k.Address {
+		return nil, fmt.Errorf("key belongs to %s, not %s", w.address, k.Address)
+	}
+	return w, nil
+}
+
+// n must be a power of two, scrypt uses about 128*n*r bytes
+func checkScryptParams(n, r, p, saltLen int) error {
+	if n < 2 || n > MAX_SCRYPT_N || n&(n-1) != 0 {
+		return fmt.Errorf("invalid scrypt n %d", n)
+	}
+	if r < 1 || r > MAX_SCRYPT_R {
+		return fmt.Errorf("invalid scrypt r %d", r)
+	}
+	if p < 1 || p > MAX_SCRYPT_P {
+		return fmt.Errorf("invalid scrypt p %d", p)
+	}
+	if 128*n*r > MAX_SCRYPT_MEMORY {
+		return fmt.Errorf("scrypt n %d and r %d need more than %d bytes", n, r, MAX_SCRYPT_MEMORY)
+	}
+	if saltLen < 16 || saltLen > 64 {
+		return fmt.Errorf("invalid salt length %d", saltLen)
+	}
+	return nil
+}
+
+// directory of encrypted wallets, one file per address. unlocked wallets are
+// kept in memory until they are locked again
+type Keystore struct {
+	dir      string
+	unlocked map[string]*Wallet
+	mux      sync.Mutex
+}
+
+// open the keystore in dir, creating it if needed
+func NewKeystore(dir string) (*Keystore, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	return &Keystore{dir: dir, unlocked: make(map[string]*Wallet)}, nil
+}
+
+func (ks *Keystore) path(address string) (string, error) {
+	if !utils.ValidAddress(address) {
+		return "", fmt.Errorf("invalid address %q", address)
+	}
+	return filepath.Join(ks.dir, address+".json"), nil
+}
+
+// encrypt the wallet with passphrase and write it to the keystore, replacing
+// what was stored for its address
+func (ks *Keystore) Store(w *Wallet, passphrase string) error {
+	k, err := Encrypt(w, passphrase)
+	if err != nil {
+		return err
+	}
+	path, err := ks.path(w.address)
+	if err != nil {
+		return err
+	}
+	m, err := json.MarshalIndent(k, "", "  ")
+	if err != nil {
+		return err
+	}
+	return utils.WriteFileAtomic(path, m)
+}
+
+// encrypted key stored for address
+func (ks *Keystore) Load(address string) (*EncryptedKey, error) {
+	path, err := ks.path(address)
+	if err != nil {
+		return nil, err
+	}
+	m, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrUnknownWallet
+	}
+	if err != nil {
+		return nil, err
+	}
+	var k EncryptedKey
+	if err := json.Unmarshal(m, &k); err != nil {
+		return nil, err
+	}
+	if k.Address != address {
+		return nil, fmt.Errorf("key file for %s holds %s", address, k.Address)
+	}
+	return &k, nil
+}
+
+// decrypt the wallet stored for address and keep it unlocked
+func (ks *Keystore) Unlock(address string, passphrase string) (*Wallet, error) {
+	k, err := ks.Load(address)
+	if err != nil {
+		return nil, err
+	}
+	w, err := Decrypt(k, passphrase)
+	if err != nil {
+		return nil, err
+	}
+	ks.mux.Lock()
+	defer ks.mux.Unlock()
+	ks.unlocked[address] = w
+	return w, nil
+}
+
+// forget the decrypted wallet, it has to be unlocked again to sign
+func (ks *Keystore) Lock(address string) {
+	ks.mux.Lock()
+	defer ks.mux.Unlock()
+	delete(ks.unlocked, address)
+}
+
+// unlocked wallet for address
+func (ks *Keystore) Wallet(address string) (*Wallet, error) {
+	ks.mux.Lock()
+	defer ks.mux.Unlock()
+	w, ok := ks.unlocked[address]
+	if !ok {
+		return nil, ErrWalletLocked
+	}
+	return w, nil
+}
+
+func (ks *Keystore) Unlocked(address string) bool {
+	ks.mux.Lock()
+	defer ks.mux.Unlock()
+	_, ok := ks.unlocked[address]
+	return ok
+}
+
+// addresses with a stored wallet, sorted
+func (ks *Keystore) List() ([]string, error) {
+	entries, err := os.ReadDir(ks.dir)
+	if err != nil {
+		return nil, err
+	}
+	addresses := make([]string, 0)
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || !strings.HasSuffix(name, ".json") {
+			continue
+		}
+		if address := strings.TrimSuffix(name, ".json"); utils.ValidAddress(address) {
+			addresses = append(addresses, address)
+		}
+	}
+	sort.Strings(addresses)
+	return addresses, nil
+}
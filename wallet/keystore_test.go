@@ -0,0 +1,80 @@
+package wallet
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestKeystoreRoundTrip(t *testing.T) {
+	ks, err := NewKeystore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := NewWallet()
+	if err := ks.Store(w, "correct horse"); err != nil {
+		t.Fatal(err)
+	}
+	if addresses, err := ks.List(); err != nil || len(addresses) != 1 || addresses[0] != w.Address() {
+		t.Fatalf("List() = %v, %v, want [%s]", addresses, err, w.Address())
+	}
+	if _, err := ks.Wallet(w.Address()); !errors.Is(err, ErrWalletLocked) {
+		t.Errorf("stored wallet error %v, want locked", err)
+	}
+	if _, err := ks.Unlock(w.Address(), "wrong horse"); !errors.Is(err, ErrWrongPassphrase) {
+		t.Errorf("wrong passphrase error %v, want %v", err, ErrWrongPassphrase)
+	}
+	unlocked, err := ks.Unlock(w.Address(), "correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if unlocked.PrivateKeyStr() != w.PrivateKeyStr() || unlocked.Address() != w.Address() {
+		t.Error("unlocked wallet differs from the stored one")
+	}
+	if got, err := ks.Wallet(w.Address()); err != nil || got != unlocked {
+		t.Errorf("Wallet() = %v, %v after unlocking", got, err)
+	}
+	ks.Lock(w.Address())
+	if ks.Unlocked(w.Address()) {
+		t.Error("wallet still unlocked after Lock")
+	}
+	if _, err := ks.Load(NewWallet().Address()); !errors.Is(err, ErrUnknownWallet) {
+		t.Errorf("unknown address error %v, want %v", err, ErrUnknownWallet)
+	}
+	// nothing but the key file is left behind
+	entries, _ := os.ReadDir(ks.dir)
+	if len(entries) != 1 {
+		t.Errorf("keystore holds %d files, want 1", len(entries))
+	}
+}
+
+func TestDecryptRejects(t *testing.T) {
+	w := NewWallet()
+	k, err := Encrypt(w, "pass")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name   string
+		tamper func(k *EncryptedKey)
+		err    string
+	}{
+		{"version", func(k *EncryptedKey) { k.Version = 2 }, "unsupported"},
+		{"n not a power of two", func(k *EncryptedKey) { k.Crypto.KDFParams.N = 1<<15 + 1 }, "invalid scrypt n"},
+		{"n too large", func(k *EncryptedKey) { k.Crypto.KDFParams.N = 1 << 30 }, "invalid scrypt n"},
+		{"r too large", func(k *EncryptedKey) { k.Crypto.KDFParams.R = 1 << 20 }, "invalid scrypt r"},
+		{"p zero", func(k *EncryptedKey) { k.Crypto.KDFParams.P = 0 }, "invalid scrypt p"},
+		{"memory", func(k *EncryptedKey) { k.Crypto.KDFParams.N, k.Crypto.KDFParams.R = MAX_SCRYPT_N, MAX_SCRYPT_R }, "need more than"},
+		{"short salt", func(k *EncryptedKey) { k.Crypto.KDFParams.Salt = "00" }, "salt length"},
+		{"other address", func(k *EncryptedKey) { k.Address = NewWallet().Address() }, ErrWrongPassphrase.Error()},
+		{"ciphertext", func(k *EncryptedKey) { k.Crypto.Ciphertext = "00" + k.Crypto.Ciphertext[2:] }, ErrWrongPassphrase.Error()},
+	}
+	for _, tt := range tests {
+		c := *k
+		tt.tamper(&c)
+		if _, err := Decrypt(&c, "pass"); err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("%s: error %v, want %q", tt.name, err, tt.err)
+		}
+	}
+}
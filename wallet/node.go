@@ -0,0 +1,53 @@
+package wallet
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/nazeemnato/stonkcoin/utils"
+)
+
+const (
+	// reward address of a node, inside its data directory
+	NODE_ADDRESS_FILE = "node.address"
+	// keystore holding the node wallet, inside its data directory
+	NODE_KEYSTORE_DIR = "keystore"
+)
+
+// reward address of the node whose data directory is dir. the first time a
+// new wallet is created, its key sealed under passphrase in the keystore in
+// dir and only the address kept in plain text, which created reports. the
+// node never signs, its owner unlocks the keystore to spend the rewards
+func NodeAddress(dir string, passphrase string) (address string, created bool, err error) {
+	path := filepath.Join(dir, NODE_ADDRESS_FILE)
+	m, err := os.ReadFile(path)
+	if err == nil {
+		address := strings.TrimSpace(string(m))
+		if !utils.ValidAddress(address) {
+			return "", false, fmt.Errorf("address file %s holds an invalid address", path)
+		}
+		return address, false, nil
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return "", false, err
+	}
+	if passphrase == "" {
+		return "", false, errors.New("a passphrase is needed to seal the new node wallet")
+	}
+	ks, err := NewKeystore(filepath.Join(dir, NODE_KEYSTORE_DIR))
+	if err != nil {
+		return "", false, err
+	}
+	w := NewWallet()
+	// the key goes first, an address without its key would burn the rewards
+	if err := ks.Store(w, passphrase); err != nil {
+		return "", false, err
+	}
+	if err := utils.WriteFileAtomic(path, []byte(w.Address()+"\n")); err != nil {
+		return "", false, err
+	}
+	return w.Address(), true, nil
+}
@@ -0,0 +1,49 @@
+package wallet
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestNodeAddress(t *testing.T) {
+	dir := t.TempDir()
+	if _, _, err := NodeAddress(dir, ""); err == nil {
+		t.Fatal("node wallet was created without a passphrase")
+	}
+	address, created, err := NodeAddress(dir, "pass")
+	if err != nil || !created {
+		t.Fatalf("NodeAddress() = %v, %v, want a new wallet", created, err)
+	}
+	// reopening needs no passphrase, only the address is read back
+	again, created, err := NodeAddress(dir, "")
+	if err != nil || created {
+		t.Fatalf("NodeAddress() = %v, %v, want the stored address", created, err)
+	}
+	if again != address {
+		t.Errorf("address %s after reopening, want %s", again, address)
+	}
+	ks, err := NewKeystore(filepath.Join(dir, NODE_KEYSTORE_DIR))
+	if err != nil {
+		t.Fatal(err)
+	}
+	w, err := ks.Unlock(address, "pass")
+	if err != nil {
+		t.Fatalf("node wallet can't be unlocked: %s", err)
+	}
+	if w.Address() != address {
+		t.Errorf("keystore holds %s, want %s", w.Address(), address)
+	}
+	m, err := os.ReadFile(filepath.Join(dir, NODE_ADDRESS_FILE))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(m), w.PrivateKeyStr()) {
+		t.Error("private key was written in plain text")
+	}
+	os.WriteFile(filepath.Join(dir, NODE_ADDRESS_FILE), []byte("not an address"), 0600)
+	if _, _, err := NodeAddress(dir, "pass"); err == nil {
+		t.Error("corrupt address file was accepted")
+	}
+}
@@ -0,0 +1,215 @@
+package wallet
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+
+	"github.com/nazeemnato/stonkcoin/utils"
+)
+
+var ErrInsufficientOutputs = errors.New("unspent outputs don't cover amount and fee")
+
+// unspent output as listed by the node's /utxos endpoint
+type Output struct {
+	TxID    string       `json:"txId"`
+	Index   uint32       `json:"index"`
+	Address string       `json:"address"`
+	Amount  utils.Amount `json:"amount"`
+}
+
+type utxoOutput struct {
+	Address string       `json:"address"`
+	Amount  utils.Amount `json:"amount"`
+}
+
+// utxo transaction spending outputs of a single key. every input is signed
+// with that key, a deposit is debited from its account
+type UTXOTransaction struct {
+	privateKey *ecdsa.PrivateKey
+	publicKey  *ecdsa.PublicKey
+	inputs     []*Output
+	outputs    []utxoOutput
+	fee        utils.Amount
+	// account deposit, senderAddress is empty without one
+	senderAddress string
+	deposit       utils.Amount
+	nonce         uint64
+}
+
+// pay amount to recipient out of the available outputs, which must belong to
+// publicKey. outputs are used in the given order until amount and fee are
+// covered, whatever is left goes back to the key's address as change
+func NewUTXOTransaction(privateKey *ecdsa.PrivateKey, publicKey *ecdsa.PublicKey, available []*Output, recipient string, amount utils.Amount, fee utils.Amount) (*UTXOTransaction, error) {
+	if amount <= 0 {
+		return nil, fmt.Errorf("amount must be positive")
+	}
+	if fee < 0 {
+		return nil, fmt.Errorf("fee must not be negative")
+	}
+	target, err := amount.Add(fee)
+	if err != nil {
+		return nil, err
+	}
+	self := utils.AddressFromPublicKey(publicKey)
+	var inputs []*Output
+	var total utils.Amount
+	for _, o := range available {
+		if total >= target {
+			break
+		}
+		if o.Address != self {
+			continue
+		}
+		if total, err = total.Add(o.Amount); err != nil {
+			return nil, err
+		}
+		inputs = append(inputs, o)
+	}
+	if total < target {
+		return nil, fmt.Errorf("%w: %s available, %s needed", ErrInsufficientOutputs, total, target)
+	}
+	outputs := []utxoOutput{{recipient, amount}}
+	if change := total - target; change > 0 {
+		outputs = append(outputs, utxoOutput{self, change})
+	}
+	return &UTXOTransaction{privateKey: privateKey, publicKey: publicKey, inputs: inputs, outputs: outputs, fee: fee}, nil
+}
+
+// move amount from the key's account into a new output for recipient. the
+// account pays amount plus fee, nonce is its next sequence number
+func NewDepositTransaction(privateKey *ecdsa.PrivateKey, publicKey *ecdsa.PublicKey, recipient string, amount utils.Amount, fee utils.Amount, nonce uint64) (*UTXOTransaction, error) {
+	if amount <= 0 {
+		return nil, fmt.Errorf("amount must be positive")
+	}
+	if fee < 0 {
+		return nil, fmt.Errorf("fee must not be negative")
+	}
+	deposit, err := amount.Add(fee)
+	if err != nil {
+		return nil, err
+	}
+	return &UTXOTransaction{
+		privateKey:    privateKey,
+		publicKey:     publicKey,
+		outputs:       []utxoOutput{{recipient, amount}},
+		fee:           fee,
+		senderAddress: utils.AddressFromPublicKey(publicKey),
+		deposit:       deposit,
+		nonce:         nonce,
+	}, nil
+}
+
+func (t *UTXOTransaction) Inputs() []*Output {
+	return t.inputs
+}
+
+// create marshal json
+func (t *UTXOTransaction) MarshalJSON() ([]byte, error) {
+	// this json marshal must be in the same order as block/utxo.go utxoSigningPayload()
+	// otherwise, the signatures will be invalid
+	type input struct {
+		TxID  string `json:"txId"`
+		Index uint32 `json:"index"`
+	}
+	inputs := make([]input, len(t.inputs))
+	for i, o := range t.inputs {
+		inputs[i] = input{o.TxID, o.Index}
+	}
+	var nonce *uint64
+	if t.senderAddress != "" {
+		nonce = &t.nonce
+	}
+	return json.Marshal(struct {
+		Type          string       `json:"type"`
+		SenderAddress string       `json:"senderAddress,omitempty"`
+		Amount        utils.Amount `json:"amount,omitempty"`
+		Fee           utils.Amount `json:"fee,omitempty"`
+		Nonce         *uint64      `json:"nonce,omitempty"`
+		Inputs        []input      `json:"inputs"`
+		Outputs       []utxoOutput `json:"outputs"`
+	}{"utxo", t.senderAddress, t.deposit, t.fee, nonce, inputs, t.outputs})
+}
+
+// generate signature, the same one covers every input and the deposit
+func (t *UTXOTransaction) GenerateSignature() *utils.Signature {
+	m, _ := t.MarshalJSON()
+	return sign(t.privateKey, m)
+}
+
+// signed transaction in the form the node's /transaction/utxo endpoint
+// takes. the payload is signed once, the signature goes on every input
+func (t *UTXOTransaction) SignedJSON() ([]byte, error) {
+	publicKey := utils.PublicKeyString(t.publicKey)
+	signature := t.GenerateSignature().String()
+	type input struct {
+		TxID      string `json:"txId"`
+		Index     uint32 `json:"index"`
+		PublicKey string `json:"publicKey"`
+		Signature string `json:"signature"`
+	}
+	inputs := make([]input, len(t.inputs))
+	for i, o := range t.inputs {
+		inputs[i] = input{o.TxID, o.Index, publicKey, signature}
+	}
+	var senderPublicKey, depositSignature string
+	if t.senderAddress != "" {
+		senderPublicKey = publicKey
+		depositSignature = signature
+	}
+	return json.Marshal(struct {
+		Type            string       `json:"type"`
+		SenderAddress   string       `json:"senderAddress,omitempty"`
+		Amount          utils.Amount `json:"amount"`
+		Fee             utils.Amount `json:"fee"`
+		Nonce           uint64       `json:"nonce"`
+		SenderPublicKey string       `json:"senderPublicKey,omitempty"`
+		Signature       string       `json:"signature,omitempty"`
+		Inputs          []input      `json:"inputs"`
+		Outputs         []utxoOutput `json:"outputs"`
+	}{"utxo", t.senderAddress, t.deposit, t.fee, t.nonce, senderPublicKey, depositSignature, inputs, t.outputs})
+}
+
+// ask the node for the unspent outputs of address that no pending
+// transaction spends yet
+func (c *Client) UTXOs(address string) ([]*Output, error) {
+	endpoint := fmt.Sprintf("%s/utxos?address=%s", c.gateway, url.QueryEscape(address))
+	res, err := c.http.Get(endpoint)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("utxos request failed: %s", res.Status)
+	}
+	var v struct {
+		Outputs []*Output `json:"outputs"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&v); err != nil {
+		return nil, err
+	}
+	return v.Outputs, nil
+}
+
+// sign t and hand it to the node
+func (c *Client) SendUTXOTransaction(t *UTXOTransaction) error {
+	m, err := t.SignedJSON()
+	if err != nil {
+		return err
+	}
+	res, err := c.http.Post(c.gateway+"/transaction/utxo", "application/json", bytes.NewReader(m))
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusCreated {
+		body, _ := io.ReadAll(res.Body)
+		return fmt.Errorf("transaction rejected: %s %s", res.Status, bytes.TrimSpace(body))
+	}
+	return nil
+}
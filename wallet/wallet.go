@@ -8,9 +8,7 @@ import (
 	"encoding/json"
 	"fmt"
 
-	"github.com/btcsuite/btcutil/base58"
 	"github.com/nazeemnato/stonkcoin/utils"
-	"golang.org/x/crypto/ripemd160"
 )
 
 type Wallet struct {
@@ -24,87 +22,143 @@ type Transaction struct {
 	publicKey        *ecdsa.PublicKey
 	senderAddress    string
 	recipientAddress string
-	amount           float32
+	amount           utils.Amount
+	fee              utils.Amount
+	nonce            uint64
 }
+
+// transfer to prepare for signing, the private key never leaves the signer
 type TransactionRequest struct {
-	SenderPrivateKey *string `json:"sender_private_key"`
-	SenderPublicKey  *string `json:"sender_public_key"`
-	SenderAddress    *string `json:"sender_address"`
-	ReceiverAddress  *string `json:"receiver_address"`
-	Amount           *string `json:"amount"`
+	SenderPublicKey *string `json:"sender_public_key"`
+	SenderAddress   *string `json:"sender_address,omitempty"`
+	ReceiverAddress *string `json:"receiver_address"`
+	Amount          *string `json:"amount"`
+	Fee             *string `json:"fee,omitempty"`
 }
 
 func (tr *TransactionRequest) Validate() bool {
-	if tr.SenderPrivateKey == nil || tr.SenderPublicKey == nil || tr.SenderAddress == nil || tr.ReceiverAddress == nil || tr.Amount == nil {
+	if tr.SenderPublicKey == nil || tr.ReceiverAddress == nil || tr.Amount == nil {
 		return false
 	}
 	return true
 }
 
-// create new transaction
-func NewTransaction(privateKey *ecdsa.PrivateKey, publicKey *ecdsa.PublicKey, senderAddr string, recipientAddr string, amount float32) *Transaction {
-	return &Transaction{privateKey, publicKey, senderAddr, recipientAddr, amount}
+// signed transfer in the form block.TransactionRequest and the node's
+// /transaction endpoint take
+type SignedTransaction struct {
+	SenderAddress   string       `json:"sender_address"`
+	ReceiverAddress string       `json:"receiver_address"`
+	SenderPublicKey string       `json:"sender_public_key"`
+	Amount          utils.Amount `json:"amount"`
+	Fee             utils.Amount `json:"fee,omitempty"`
+	Nonce           uint64       `json:"nonce"`
+	Signature       string       `json:"signature,omitempty"`
+}
+
+// create new transaction, nonce is the sender's next sequence number (see
+// Client.NextNonce) and fee what the miner gets for including it
+func NewTransaction(privateKey *ecdsa.PrivateKey, publicKey *ecdsa.PublicKey, senderAddr string, recipientAddr string, amount utils.Amount, fee utils.Amount, nonce uint64) *Transaction {
+	return &Transaction{privateKey, publicKey, senderAddr, recipientAddr, amount, fee, nonce}
+}
+
+// create new transaction to be signed elsewhere, see Payload and Wallet.Sign
+func NewUnsignedTransaction(publicKey *ecdsa.PublicKey, senderAddr string, recipientAddr string, amount utils.Amount, fee utils.Amount, nonce uint64) *Transaction {
+	return &Transaction{nil, publicKey, senderAddr, recipientAddr, amount, fee, nonce}
+}
+
+func (t *Transaction) Nonce() uint64 {
+	return t.nonce
+}
+
+// bytes the signature covers
+func (t *Transaction) Payload() []byte {
+	m, _ := t.MarshalJSON()
+	return m
+}
+
+// request carrying signature, which has to be over Payload. without a
+// signature it is what a signer needs besides the payload
+func (t *Transaction) Signed(signature *utils.Signature) *SignedTransaction {
+	st := &SignedTransaction{
+		SenderAddress:   t.senderAddress,
+		ReceiverAddress: t.recipientAddress,
+		SenderPublicKey: utils.PublicKeyString(t.publicKey),
+		Amount:          t.amount,
+		Fee:             t.fee,
+		Nonce:           t.nonce,
+	}
+	if signature != nil {
+		st.Signature = signature.String()
+	}
+	return st
 }
 
 // create marshal json
 func (t *Transaction) MarshalJSON() ([]byte, error) {
-	// this json marshal must be in the same order as block/transaction.go MarshalJSON()
+	// this json marshal must be in the same order as block/transaction.go SigningPayload()
 	// otherwise, the signature will be invalid
 	return json.Marshal(struct {
-		SenderAddress    string  `json:"senderAddress"`
-		RecipientAddress string  `json:"recipientAddress"`
-		Amount           float32 `json:"amount"`
+		SenderAddress    string       `json:"senderAddress"`
+		RecipientAddress string       `json:"recipientAddress"`
+		Amount           utils.Amount `json:"amount"`
+		Fee              utils.Amount `json:"fee,omitempty"`
+		Nonce            uint64       `json:"nonce"`
 	}{
 		t.senderAddress,
 		t.recipientAddress,
 		t.amount,
+		t.fee,
+		t.nonce,
 	})
 }
 
-// generate signature
+// generate signature, only for transactions created with a private key
 func (t *Transaction) GenerateSignature() *utils.Signature {
-	m, _ := t.MarshalJSON()
-	h := sha256.Sum256(m)
-	r, s, _ := ecdsa.Sign(rand.Reader, t.privateKey, h[:])
+	return sign(t.privateKey, t.Payload())
+}
+
+func sign(privateKey *ecdsa.PrivateKey, payload []byte) *utils.Signature {
+	h := sha256.Sum256(payload)
+	r, s, _ := ecdsa.Sign(rand.Reader, privateKey, h[:])
 	return &utils.Signature{R: r, S: s}
 }
 
 // create new wallet
 func NewWallet() *Wallet {
-	w := new(Wallet)
 	privateKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
-	publicKey := &privateKey.PublicKey
+	return walletFromKey(privateKey)
+}
+
+// rebuild the wallet of an existing private key. only its scalar is used, the
+// public key and address are derived again
+func FromPrivateKey(privateKey *ecdsa.PrivateKey) (*Wallet, error) {
+	if privateKey == nil {
+		return nil, fmt.Errorf("no private key")
+	}
+	if privateKey.Curve != nil && privateKey.Curve != elliptic.P256() {
+		return nil, fmt.Errorf("private key is not on the P-256 curve")
+	}
+	k, err := utils.PrivateKeyFromScalar(privateKey.D)
+	if err != nil {
+		return nil, err
+	}
+	return walletFromKey(k), nil
+}
+
+// rebuild a wallet from the hex private key PrivateKeyStr or Export gives
+func FromHex(s string) (*Wallet, error) {
+	k, err := utils.ParsePrivateKey(s)
+	if err != nil {
+		return nil, err
+	}
+	return walletFromKey(k), nil
+}
+
+func walletFromKey(privateKey *ecdsa.PrivateKey) *Wallet {
+	w := new(Wallet)
 	w.privateKey = privateKey
-	w.publicKey = publicKey
-	// perform sha256 on public key
-	h2 := sha256.New()
-	h2.Write(w.publicKey.X.Bytes())
-	h2.Write(w.publicKey.Y.Bytes())
-	digest2 := h2.Sum(nil)
-	// perform ripemd160 on sha256
-	h3 := ripemd160.New()
-	h3.Write(digest2)
-	digest3 := h3.Sum(nil)
-	// add version byte (0x00)
-	vd4 := make([]byte, 21)
-	vd4[0] = 0x00
-	copy(vd4[1:], digest3)
-	// perform sha256 on extended version byte
-	h5 := sha256.New()
-	h5.Write(vd4)
-	digest5 := h5.Sum(nil)
-	// perform sha256 on sha256
-	h6 := sha256.New()
-	h6.Write(digest5)
-	digest6 := h6.Sum(nil)
-	// take first 4 bytes of sha256 for checksum
-	checksum := digest6[:4]
-	// add checksum to extended version byte from above
-	dc8 := make([]byte, 25)
-	copy(dc8[:21], vd4[:])
-	copy(dc8[21:], checksum[:])
-	// base58 encode
-	w.address = base58.Encode(dc8)
+	w.publicKey = &privateKey.PublicKey
+	w.address = utils.AddressFromPublicKey(w.publicKey)
 	return w
 }
 
@@ -115,8 +169,7 @@ func (w *Wallet) PrivateKey() *ecdsa.PrivateKey {
 
 // get private key in hex
 func (w *Wallet) PrivateKeyStr() string {
-	// return w.privateKey.D.Text(16)
-	return fmt.Sprintf("%x", w.privateKey.D.Bytes())
+	return fmt.Sprintf("%064x", w.privateKey.D.Bytes())
 }
 
 // get public key
@@ -134,8 +187,25 @@ func (w *Wallet) Address() string {
 	return w.address
 }
 
-// marshal json
+// sign a payload prepared by a wallet server, the key stays with the wallet
+func (w *Wallet) Sign(payload []byte) *utils.Signature {
+	return sign(w.privateKey, payload)
+}
+
+// marshal json, the private key is left out, see Export
 func (w *Wallet) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		PublicKey string `json:"publicKey"`
+		Address   string `json:"address"`
+	}{
+		w.PublicKeyStr(),
+		w.Address(),
+	})
+}
+
+// json including the plaintext private key, for handing the wallet to its
+// owner. use a Keystore to keep it anywhere
+func (w *Wallet) Export() ([]byte, error) {
 	return json.Marshal(struct {
 		PrivateKey string `json:"privateKey"`
 		PublicKey  string `json:"publicKey"`
@@ -0,0 +1,114 @@
+package wallet
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"fmt"
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/nazeemnato/stonkcoin/block"
+	"github.com/nazeemnato/stonkcoin/utils"
+)
+
+// the wallet signs Payload and the chain verifies SigningPayload, they must
+// be the same bytes
+func TestPayloadMatchesBlock(t *testing.T) {
+	w := NewWallet()
+	recipient := NewWallet().Address()
+	tests := []struct {
+		name   string
+		amount utils.Amount
+		fee    utils.Amount
+		nonce  uint64
+	}{
+		{"no fee", utils.COIN, 0, 0},
+		{"fee", utils.COIN + utils.COIN/3, utils.COIN / 100, 7},
+		{"smallest amount", 1, 1, 1 << 40},
+	}
+	for _, tt := range tests {
+		wt := NewUnsignedTransaction(w.PublicKey(), w.Address(), recipient, tt.amount, tt.fee, tt.nonce)
+		bt := block.NewTransaction(w.Address(), recipient, tt.amount, tt.fee, tt.nonce)
+		if !bytes.Equal(wt.Payload(), bt.SigningPayload()) {
+			t.Errorf("%s: wallet payload %s, chain payload %s", tt.name, wt.Payload(), bt.SigningPayload())
+			continue
+		}
+		signature := w.Sign(wt.Payload())
+		signed := block.NewSignedTransaction(w.Address(), recipient, tt.amount, tt.fee, tt.nonce, w.PublicKey(), signature)
+		if err := signed.Verify(); err != nil {
+			t.Errorf("%s: wallet signature rejected: %s", tt.name, err)
+		}
+		// the signature covers every field
+		other := block.NewSignedTransaction(w.Address(), recipient, tt.amount+1, tt.fee, tt.nonce, w.PublicKey(), signature)
+		if other.Verify() == nil {
+			t.Errorf("%s: signature verified a different amount", tt.name)
+		}
+	}
+}
+
+func TestFromHex(t *testing.T) {
+	w := NewWallet()
+	n := elliptic.P256().Params().N
+	tests := []struct {
+		name  string
+		hex   string
+		valid bool
+	}{
+		{"own key", w.PrivateKeyStr(), true},
+		{"leading zeros left out", "1", true},
+		{"largest scalar", fmt.Sprintf("%x", new(big.Int).Sub(n, big.NewInt(1))), true},
+		{"empty", "", false},
+		{"zero", strings.Repeat("0", 64), false},
+		{"order of the curve", fmt.Sprintf("%x", n), false},
+		{"above the order", strings.Repeat("f", 64), false},
+		{"too long", "0" + w.PrivateKeyStr(), false},
+		{"not hex", strings.Repeat("g", 64), false},
+	}
+	for _, tt := range tests {
+		if _, err := FromHex(tt.hex); (err == nil) != tt.valid {
+			t.Errorf("%s: error %v, want valid %v", tt.name, err, tt.valid)
+		}
+	}
+	imported, err := FromHex(w.PrivateKeyStr())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if imported.PublicKeyStr() != w.PublicKeyStr() || imported.Address() != w.Address() {
+		t.Errorf("imported %s, want %s", imported.Address(), w.Address())
+	}
+}
+
+func TestFromPrivateKey(t *testing.T) {
+	w := NewWallet()
+	other, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name  string
+		key   *ecdsa.PrivateKey
+		valid bool
+	}{
+		{"own key", w.PrivateKey(), true},
+		// the public key is derived again, only the scalar is needed
+		{"scalar only", &ecdsa.PrivateKey{D: w.PrivateKey().D}, true},
+		{"nil", nil, false},
+		{"no scalar", &ecdsa.PrivateKey{}, false},
+		{"zero", &ecdsa.PrivateKey{D: big.NewInt(0)}, false},
+		{"order of the curve", &ecdsa.PrivateKey{D: elliptic.P256().Params().N}, false},
+		{"other curve", other, false},
+	}
+	for _, tt := range tests {
+		imported, err := FromPrivateKey(tt.key)
+		if (err == nil) != tt.valid {
+			t.Errorf("%s: error %v, want valid %v", tt.name, err, tt.valid)
+			continue
+		}
+		if tt.valid && (imported.PublicKeyStr() != w.PublicKeyStr() || imported.Address() != w.Address()) {
+			t.Errorf("%s: imported %s, want %s", tt.name, imported.Address(), w.Address())
+		}
+	}
+}
@@ -8,7 +8,7 @@ import (
 	"io"
 	"log"
 	"net/http"
-	"strconv"
+	"strings"
 	"text/template"
 
 	"github.com/nazeemnato/stonkcoin/block"
@@ -19,10 +19,11 @@ import (
 type WalletServer struct {
 	port    uint16
 	gateway string
+	client  *wallet.Client
 }
 
 func NewWalletServer(port uint16, gateway string) *WalletServer {
-	return &WalletServer{port, gateway}
+	return &WalletServer{port, gateway, wallet.NewClient(gateway)}
 }
 
 func (ws *WalletServer) Gateway() string {
@@ -43,64 +44,218 @@ func (ws *WalletServer) Index(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-func (ws *WalletServer) CreateWallet(w http.ResponseWriter, r *http.Request) {
+// rebuild a wallet from an existing private key and return it. nothing is
+// stored and the key is not logged, the page imports keys in the browser
+// instead
+func (ws *WalletServer) ImportWallet(w http.ResponseWriter, r *http.Request) {
 	switch r.Method {
 	case http.MethodPost:
 		w.Header().Set("Content-Type", "application/json")
-		wlt := wallet.NewWallet()
-		m, _ := wlt.MarshalJSON()
+		decoder := json.NewDecoder(r.Body)
+		decoder.DisallowUnknownFields()
+		var req struct {
+			PrivateKey *string `json:"private_key"`
+		}
+		if err := decoder.Decode(&req); err != nil || req.PrivateKey == nil {
+			w.WriteHeader(http.StatusBadRequest)
+			io.WriteString(w, string(utils.Json("Missing private key")))
+			return
+		}
+		wlt, err := wallet.FromHex(strings.TrimSpace(*req.PrivateKey))
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			io.WriteString(w, string(utils.Json(fmt.Sprintf("Invalid private key: %s", err))))
+			return
+		}
+		// the caller has the private key already, it isn't sent back
+		m, err := wlt.MarshalJSON()
+		if err != nil {
+			log.Printf("Error encoding wallet: %s\n", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
 		io.WriteString(w, string(m[:]))
 	default:
 		w.WriteHeader(http.StatusMethodNotAllowed)
 	}
 }
 
-func (ws *WalletServer) CreateTransaction(w http.ResponseWriter, r *http.Request) {
+// address of a public key. the page generates or imports the key pair
+// itself and only sends the public key, its private keys never reach this
+// server
+func (ws *WalletServer) WalletAddress(w http.ResponseWriter, r *http.Request) {
 	switch r.Method {
 	case http.MethodPost:
+		w.Header().Set("Content-Type", "application/json")
 		decoder := json.NewDecoder(r.Body)
-		var t wallet.TransactionRequest
-		err := decoder.Decode(&t)
+		decoder.DisallowUnknownFields()
+		var req struct {
+			PublicKey *string `json:"public_key"`
+		}
+		if err := decoder.Decode(&req); err != nil || req.PublicKey == nil {
+			w.WriteHeader(http.StatusBadRequest)
+			io.WriteString(w, string(utils.Json("Only a public key is accepted")))
+			return
+		}
+		publicKey, err := utils.ParsePublicKey(strings.TrimSpace(*req.PublicKey))
 		if err != nil {
-			log.Println("Error")
-			io.WriteString(w, string(utils.Json("Error")))
+			w.WriteHeader(http.StatusBadRequest)
+			io.WriteString(w, string(utils.Json(fmt.Sprintf("Invalid public key: %s", err))))
+			return
+		}
+		m, _ := json.Marshal(struct {
+			PublicKey string `json:"publicKey"`
+			Address   string `json:"address"`
+		}{
+			utils.PublicKeyString(publicKey),
+			utils.AddressFromPublicKey(publicKey),
+		})
+		io.WriteString(w, string(m))
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// build the transfer and return what the sender has to sign. keys are never
+// sent here, the browser or the wallet package signs the payload locally
+func (ws *WalletServer) PrepareTransaction(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodPost:
+		w.Header().Set("Content-Type", "application/json")
+		decoder := json.NewDecoder(r.Body)
+		decoder.DisallowUnknownFields()
+		var t wallet.TransactionRequest
+		if err := decoder.Decode(&t); err != nil {
+			log.Printf("Error decoding transaction: %s\n", err)
+			w.WriteHeader(http.StatusBadRequest)
+			io.WriteString(w, string(utils.Json("Error decoding transaction")))
 			return
 		}
 		if !t.Validate() {
 			log.Println("Missing fields")
+			w.WriteHeader(http.StatusBadRequest)
 			io.WriteString(w, string(utils.Json("Missing fields")))
 			return
 		}
-		value, err := strconv.ParseFloat(*t.Amount, 32)
+		publicKey, err := utils.ParsePublicKey(*t.SenderPublicKey)
 		if err != nil {
-			log.Println("Error")
+			log.Printf("Error decoding public key: %s\n", err)
+			w.WriteHeader(http.StatusBadRequest)
+			io.WriteString(w, string(utils.Json("Invalid public key")))
+			return
+		}
+		sender := utils.AddressFromPublicKey(publicKey)
+		if t.SenderAddress != nil && *t.SenderAddress != sender {
+			w.WriteHeader(http.StatusBadRequest)
+			io.WriteString(w, string(utils.Json("Public key does not belong to the sender address")))
+			return
+		}
+		if !utils.ValidAddress(*t.ReceiverAddress) {
+			w.WriteHeader(http.StatusBadRequest)
+			io.WriteString(w, string(utils.Json("Invalid receiver address")))
+			return
+		}
+		amount, err := utils.ParseAmount(*t.Amount)
+		if err != nil {
+			log.Printf("Error parsing amount: %s\n", err)
+			w.WriteHeader(http.StatusBadRequest)
+			io.WriteString(w, string(utils.Json(fmt.Sprintf("Invalid amount: %s", err))))
+			return
+		}
+		var fee utils.Amount
+		if t.Fee != nil && *t.Fee != "" {
+			if fee, err = utils.ParseAmount(*t.Fee); err != nil {
+				log.Printf("Error parsing fee: %s\n", err)
+				w.WriteHeader(http.StatusBadRequest)
+				io.WriteString(w, string(utils.Json(fmt.Sprintf("Invalid fee: %s", err))))
+				return
+			}
+		}
+		nonce, err := ws.client.NextNonce(sender)
+		if err != nil {
+			log.Printf("Error fetching nonce: %s\n", err)
+			w.WriteHeader(http.StatusBadGateway)
 			io.WriteString(w, string(utils.Json("Error")))
 			return
 		}
-		publicKey := utils.PublicKeyFromString(*t.SenderPublicKey)
-		privateKey := utils.PrivateKeyFromString(*t.SenderPrivateKey, publicKey)
-		amount := float32(value)
 
-		transaction := wallet.NewTransaction(privateKey, publicKey, *t.SenderAddress, *t.ReceiverAddress, amount)
-		signature := transaction.GenerateSignature()
-		signatureStr := signature.String()
+		transaction := wallet.NewUnsignedTransaction(publicKey, sender, *t.ReceiverAddress, amount, fee, nonce)
+		m, _ := json.Marshal(struct {
+			Payload     string                    `json:"payload"`
+			Transaction *wallet.SignedTransaction `json:"transaction"`
+		}{
+			string(transaction.Payload()),
+			transaction.Signed(nil),
+		})
+		io.WriteString(w, string(m))
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
 
-		bt := block.TransactionRequest{
-			ReceiverAddress: t.ReceiverAddress,
-			SenderAddress:   t.SenderAddress,
-			SenderPublicKey: t.SenderPublicKey,
-			Amount:          &amount,
-			Signature:       &signatureStr,
+// relay a signed transfer to the gateway. anything carrying more than
+// block.TransactionRequest, a private key in particular, is refused
+func (ws *WalletServer) RelayTransaction(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodPost:
+		w.Header().Set("Content-Type", "application/json")
+		decoder := json.NewDecoder(r.Body)
+		decoder.DisallowUnknownFields()
+		var t block.TransactionRequest
+		if err := decoder.Decode(&t); err != nil {
+			log.Printf("Error decoding transaction: %s\n", err)
+			w.WriteHeader(http.StatusBadRequest)
+			io.WriteString(w, string(utils.Json("Only signed transactions are accepted")))
+			return
+		}
+		if !t.Validate() {
+			log.Println("Missing fields")
+			w.WriteHeader(http.StatusBadRequest)
+			io.WriteString(w, string(utils.Json("Missing fields")))
+			return
+		}
+		publicKey, err := utils.ParsePublicKey(*t.SenderPublicKey)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			io.WriteString(w, string(utils.Json("Invalid public key")))
+			return
+		}
+		signature, err := utils.ParseSignature(*t.Signature)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			io.WriteString(w, string(utils.Json("Invalid signature")))
+			return
+		}
+		var fee utils.Amount
+		if t.Fee != nil {
+			fee = *t.Fee
+		}
+		// catch bad signatures before they reach the gateway
+		bt := block.NewSignedTransaction(*t.SenderAddress, *t.ReceiverAddress, *t.Amount, fee, *t.Nonce, publicKey, signature)
+		if err := bt.Verify(); err != nil {
+			log.Printf("Invalid transaction: %s\n", err)
+			w.WriteHeader(http.StatusBadRequest)
+			io.WriteString(w, string(utils.Json(fmt.Sprintf("Invalid transaction: %s", err))))
+			return
 		}
 
-		m, _ := json.Marshal(bt)
-		buf := bytes.NewBuffer(m)
-		req, _ := http.Post(ws.Gateway()+"/transaction", "application/json", buf)
-		if req.StatusCode == http.StatusCreated {
+		m, _ := json.Marshal(t)
+		res, err := http.Post(ws.Gateway()+"/transaction", "application/json", bytes.NewBuffer(m))
+		if err != nil {
+			log.Printf("Error relaying transaction: %s\n", err)
+			w.WriteHeader(http.StatusBadGateway)
+			io.WriteString(w, string(utils.Json("Error")))
+			return
+		}
+		defer res.Body.Close()
+		if res.StatusCode == http.StatusCreated {
+			w.WriteHeader(http.StatusCreated)
 			io.WriteString(w, string(utils.Json("Success")))
 			return
 		}
-		io.WriteString(w, string(utils.Json("Error")))
+		// pass on why the gateway refused it
+		w.WriteHeader(res.StatusCode)
+		io.Copy(w, res.Body)
 	default:
 		w.WriteHeader(http.StatusMethodNotAllowed)
 	}
@@ -131,9 +286,13 @@ func (ws *WalletServer) WalletBalance(w http.ResponseWriter, r *http.Request) {
 				return
 			} else {
 				m, _ := json.Marshal(struct {
-					Balance float32 `json:"balance"`
+					Balance   utils.Amount `json:"balance"`
+					Spendable utils.Amount `json:"spendable"`
+					Immature  utils.Amount `json:"immature"`
 				}{
-					Balance: bar.Amount,
+					Balance:   bar.Amount,
+					Spendable: bar.Spendable,
+					Immature:  bar.Immature,
 				})
 				io.WriteString(w, string(m[:]))
 				return
@@ -147,8 +306,10 @@ func (ws *WalletServer) WalletBalance(w http.ResponseWriter, r *http.Request) {
 
 func (ws *WalletServer) Start() {
 	http.HandleFunc("/", ws.Index)
-	http.HandleFunc("/create", ws.CreateWallet)
-	http.HandleFunc("/transaction", ws.CreateTransaction)
+	http.HandleFunc("/import", ws.ImportWallet)
+	http.HandleFunc("/address", ws.WalletAddress)
+	http.HandleFunc("/transaction/prepare", ws.PrepareTransaction)
+	http.HandleFunc("/transaction", ws.RelayTransaction)
 	http.HandleFunc("/balance", ws.WalletBalance)
 	log.Fatal(http.ListenAndServe(fmt.Sprintf(":%d", ws.port), nil))
 }